@@ -1,7 +1,19 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
 	"github.com/nint8835/discordgo"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 
 	"github.com/nint8835/duckdbot/pkg/config"
@@ -9,31 +21,143 @@ import (
 	"github.com/nint8835/duckdbot/pkg/importer"
 )
 
+var importChannelIds []string
+var importSince string
+var importUntil string
+
+// parseImportTime parses a time given to the import command, either as a date or a full RFC 3339 timestamp.
+// Dates are interpreted as midnight UTC.
+func parseImportTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := time.Parse(time.DateOnly, value)
+	if err == nil {
+		return &parsed, nil
+	}
+
+	parsed, err = time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %s, expected a date like 2006-01-02 or an RFC 3339 timestamp", value)
+	}
+
+	return &parsed, nil
+}
+
 var importCmd = &cobra.Command{
 	Use:   "import",
 	Short: "Import all data into the database",
 
 	Run: func(cmd *cobra.Command, args []string) {
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// Restore default signal handling once cancelled, so a second interrupt exits immediately
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+
 		cfg, err := config.Load()
 		checkError(err, "failed to load config")
 
-		db, err := database.Open(cfg)
-		checkError(err, "failed to open database")
-		defer db.Close()
+		// A one-off run of specific channels replaces any configured include filters, but still respects exclusions
+		if len(importChannelIds) > 0 {
+			cfg.IncludeChannelIds = importChannelIds
+			cfg.IncludeCategoryIds = nil
+			cfg.IncludeChannelNames = nil
+		}
 
-		session, err := discordgo.New("Bot " + cfg.DiscordToken)
-		checkError(err, "failed to create session")
+		cfg.ImportSince, err = parseImportTime(importSince)
+		checkError(err, "failed to parse --since")
 
-		session.Identify.Intents = discordgo.MakeIntent(discordgo.IntentsGuildMessages | discordgo.IntentsGuildMembers)
-		err = session.Open()
+		cfg.ImportUntil, err = parseImportTime(importUntil)
+		checkError(err, "failed to parse --until")
 
-		importerInst := importer.Importer{Session: session, Db: db, Config: cfg}
+		if cfg.ImportSince != nil && cfg.ImportUntil != nil && !cfg.ImportSince.Before(*cfg.ImportUntil) {
+			log.Fatal().Msg("--since must be before --until")
+		}
 
-		err = importerInst.ImportAll()
+		err = runImport(ctx, cfg)
 		checkError(err, "failed to import guild")
 	},
 }
 
+// runImport runs an import, returning an error if it was interrupted or didn't complete cleanly.
+// The database and session are closed before it returns, so the caller can exit without skipping them.
+func runImport(ctx context.Context, cfg *config.Config) error {
+	db, err := database.Open(cfg)
+	if err != nil {
+		return fmt.Errorf("error opening database: %w", err)
+	}
+	defer db.Close()
+
+	session, err := discordgo.New("Bot " + cfg.DiscordToken)
+	if err != nil {
+		return fmt.Errorf("error creating session: %w", err)
+	}
+
+	// Server errors are returned to the importer, which retries them with backoff, rather than retried immediately by discordgo
+	session.Client.Transport = importer.NewServerErrorTransport(session.Client.Transport)
+
+	session.Identify.Intents = discordgo.MakeIntent(discordgo.IntentsGuildMessages | discordgo.IntentsGuildMembers)
+	err = session.Open()
+	if err != nil {
+		return fmt.Errorf("error opening session: %w", err)
+	}
+	defer session.Close()
+
+	importerInst := importer.Importer{Session: session, Db: db, Config: cfg}
+
+	summary, err := importerInst.ImportAll(ctx)
+	if summary != nil {
+		printRunSummary(summary)
+	}
+	if errors.Is(err, context.Canceled) {
+		log.Warn().Msg("Import interrupted, shutting down")
+		return fmt.Errorf("import interrupted: %w", err)
+	}
+	if summary != nil && len(summary.Errors) > 0 {
+		return fmt.Errorf("import failed with %d errors", len(summary.Errors))
+	}
+
+	return err
+}
+
+func printRunSummary(summary *importer.RunSummary) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(writer, "Import run %d %s\n\n", summary.RunId, summary.Status)
+	_, _ = fmt.Fprintln(writer, "ENTITY\tINSERTED\tUPDATED")
+
+	for _, entity := range slices.Sorted(maps.Keys(summary.Counts)) {
+		counts := summary.Counts[entity]
+		_, _ = fmt.Fprintf(writer, "%s\t%d\t%d\n", entity, counts.Inserted, counts.Updated)
+	}
+
+	if len(summary.SkippedChannels) > 0 {
+		_, _ = fmt.Fprintf(writer, "\n%d channels skipped:\n", len(summary.SkippedChannels))
+
+		for _, channel := range summary.SkippedChannels {
+			_, _ = fmt.Fprintf(writer, "  %s\t%s\t%s\n", channel.Id, channel.Name, channel.Reason)
+		}
+	}
+
+	if len(summary.Errors) > 0 {
+		_, _ = fmt.Fprintf(writer, "\n%d errors:\n", len(summary.Errors))
+
+		for _, err := range summary.Errors {
+			_, _ = fmt.Fprintf(writer, "  %s\n", err)
+		}
+	}
+
+	_ = writer.Flush()
+}
+
 func init() {
+	importCmd.Flags().StringSliceVar(&importChannelIds, "channel", nil, "Only import the channel with this ID and its threads, can be repeated")
+	importCmd.Flags().StringVar(&importSince, "since", "", "Only import messages sent at or after this date or RFC 3339 time")
+	importCmd.Flags().StringVar(&importUntil, "until", "", "Only import messages sent before this date or RFC 3339 time")
+
 	rootCmd.AddCommand(importCmd)
 }
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/nint8835/duckdbot/pkg/config"
+	"github.com/nint8835/duckdbot/pkg/database"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage database schema migrations",
+}
+
+var migrateDryRun bool
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply all pending migrations",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.Load()
+		checkError(err, "failed to load config")
+
+		db, err := database.Connect(cfg)
+		checkError(err, "failed to open database")
+		defer db.Close()
+
+		if migrateDryRun {
+			pending, err := database.GetPendingMigrations(db)
+			checkError(err, "failed to get pending migrations")
+
+			if len(pending) == 0 {
+				log.Info().Msg("No pending migrations")
+				return
+			}
+
+			for _, migration := range pending {
+				log.Info().Msgf("Would apply migration %d_%s", migration.Version, migration.Name)
+			}
+
+			return
+		}
+
+		applied, err := database.Migrate(db)
+		for _, migration := range applied {
+			log.Info().Msgf("Applied migration %d_%s", migration.Version, migration.Name)
+		}
+		checkError(err, "failed to apply migrations")
+
+		if len(applied) == 0 {
+			log.Info().Msg("No pending migrations")
+		}
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List migrations and whether they have been applied",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.Load()
+		checkError(err, "failed to load config")
+
+		db, err := database.Connect(cfg)
+		checkError(err, "failed to open database")
+		defer db.Close()
+
+		statuses, err := database.GetMigrationStatuses(db)
+		checkError(err, "failed to get migration status")
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED AT")
+
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+
+			_, _ = fmt.Fprintf(writer, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+
+		_ = writer.Flush()
+	},
+}
+
+func init() {
+	migrateUpCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "List pending migrations without applying them")
+
+	migrateCmd.AddCommand(migrateUpCmd)
+	migrateCmd.AddCommand(migrateStatusCmd)
+
+	rootCmd.AddCommand(migrateCmd)
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/nint8835/duckdbot/pkg/config"
+	"github.com/nint8835/duckdbot/pkg/database"
+)
+
+var runsLimit int
+
+var runsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "List recent import runs",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.Load()
+		checkError(err, "failed to load config")
+
+		db, err := database.Connect(cfg)
+		checkError(err, "failed to open database")
+		defer db.Close()
+
+		runs, err := database.GetImportRuns(db, runsLimit)
+		checkError(err, "failed to get import runs")
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(writer, "ID\tSTARTED AT\tDURATION\tSTATUS\tERRORS\tCHANGES")
+
+		for _, run := range runs {
+			duration := "-"
+			if run.FinishedAt != nil {
+				duration = run.FinishedAt.Sub(run.StartedAt).Round(time.Second).String()
+			}
+
+			// Changes are listed per entity as +inserted ~updated
+			var changes []string
+			for _, entity := range slices.Sorted(maps.Keys(run.Counts)) {
+				counts := run.Counts[entity]
+				changes = append(changes, fmt.Sprintf("%s +%d ~%d", entity, counts.Inserted, counts.Updated))
+			}
+
+			_, _ = fmt.Fprintf(
+				writer,
+				"%d\t%s\t%s\t%s\t%d\t%s\n",
+				run.Id,
+				run.StartedAt.Local().Format("2006-01-02 15:04:05"),
+				duration,
+				run.Status,
+				len(run.Errors),
+				strings.Join(changes, ", "),
+			)
+		}
+
+		_ = writer.Flush()
+	},
+}
+
+func init() {
+	runsCmd.Flags().IntVar(&runsLimit, "limit", 10, "Number of runs to list")
+
+	rootCmd.AddCommand(runsCmd)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
@@ -16,10 +17,49 @@ type Config struct {
 
 	DbPath string `split_words:"true" default:"activity.duckdb"`
 
-	DiscordToken string `split_words:"true" required:"true"`
+	// DiscordToken is excluded from JSON so it is never recorded alongside import runs
+	DiscordToken string `split_words:"true" required:"true" json:"-"`
 	GuildId      string `split_words:"true" required:"true"`
 
 	ImportOlder bool `split_words:"true" default:"false"`
+
+	// ErrorPolicy controls what happens when part of an import fails, either "continue" to import everything else
+	// and report all errors at the end, or "fail-fast" to stop at the first error
+	ErrorPolicy string `split_words:"true" default:"continue"`
+
+	// RetryAttempts is the maximum number of attempts made for a Discord request that fails with a transient error,
+	// backing off exponentially from RetryInitialBackoff to RetryMaxBackoff between attempts
+	RetryAttempts       int           `split_words:"true" default:"5"`
+	RetryInitialBackoff time.Duration `split_words:"true" default:"1s"`
+	RetryMaxBackoff     time.Duration `split_words:"true" default:"1m"`
+
+	// ImportConcurrency is the number of channels to fetch from Discord in parallel
+	ImportConcurrency int `split_words:"true" default:"4"`
+
+	// ImportPrivateThreads imports private threads visible to the bot, which are otherwise skipped
+	ImportPrivateThreads bool `split_words:"true" default:"false"`
+
+	// MemberSource controls how guild members are fetched, either "rest" to paginate the REST API or "gateway" to request member chunks over the gateway
+	MemberSource string `split_words:"true" default:"rest"`
+
+	// Channel filters restrict which channels are imported, matching channels by ID, by the ID of their category, or by
+	// a glob of their name. If any include filters are set only matching channels are imported, and channels matching
+	// an exclude filter are never imported. Threads are imported along with their parent channel, unless excluded by ID or name.
+	IncludeChannelIds   []string `split_words:"true"`
+	IncludeCategoryIds  []string `split_words:"true"`
+	IncludeChannelNames []string `split_words:"true"`
+	ExcludeChannelIds   []string `split_words:"true"`
+	ExcludeCategoryIds  []string `split_words:"true"`
+	ExcludeChannelNames []string `split_words:"true"`
+
+	// ImportSince and ImportUntil limit the import to messages sent within a time window, re-importing every message
+	// within it rather than resuming from checkpoints. They're set by the import command's --since and --until flags.
+	ImportSince *time.Time `ignored:"true"`
+	ImportUntil *time.Time `ignored:"true"`
+
+	// Reconcile re-walks the most recent ReconcileWindow of each channel, updating edited messages and marking deleted ones
+	Reconcile       bool          `split_words:"true" default:"false"`
+	ReconcileWindow time.Duration `split_words:"true" default:"168h"`
 }
 
 func initLoggingConfig(config Config) error {
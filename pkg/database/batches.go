@@ -0,0 +1,175 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/nint8835/discordgo"
+)
+
+// MessagePage is a page of messages fetched from Discord.
+type MessagePage struct {
+	Messages []*discordgo.Message
+
+	// ReactionBurstCounts maps a message ID to the burst count of each of its reactions, in the same order as the
+	// message's Reactions, as discordgo doesn't decode burst counts
+	ReactionBurstCounts map[string][]int
+}
+
+func insertMessages(tx *sql.Tx, page MessagePage) (UpsertCounts, error) {
+	counts, err := UpsertMessages(tx, page.Messages)
+	if err != nil {
+		return UpsertCounts{}, fmt.Errorf("error inserting messages: %w", err)
+	}
+
+	err = ReplaceAttachments(tx, page.Messages)
+	if err != nil {
+		return UpsertCounts{}, fmt.Errorf("error inserting attachments: %w", err)
+	}
+
+	err = ReplaceReactions(tx, page)
+	if err != nil {
+		return UpsertCounts{}, fmt.Errorf("error inserting reactions: %w", err)
+	}
+
+	err = ReplaceMentions(tx, page.Messages)
+	if err != nil {
+		return UpsertCounts{}, fmt.Errorf("error inserting mentions: %w", err)
+	}
+
+	return counts, nil
+}
+
+// InsertMessages stores a page of messages, along with their attachments, reactions and mentions, in a single transaction.
+func InsertMessages(db *sql.DB, page MessagePage) (UpsertCounts, error) {
+	var counts UpsertCounts
+
+	err := InTransaction(db, func(tx *sql.Tx) error {
+		var err error
+		counts, err = insertMessages(tx, page)
+		return err
+	})
+	if err != nil {
+		return UpsertCounts{}, err
+	}
+
+	return counts, nil
+}
+
+// InsertMessagesWithCheckpoint stores a page of messages and advances the channel's import checkpoint in a single transaction,
+// so an interrupted import can resume from the last fully written page.
+func InsertMessagesWithCheckpoint(db *sql.DB, page MessagePage, channelId string, direction string, cursor string) (UpsertCounts, error) {
+	var counts UpsertCounts
+
+	err := InTransaction(db, func(tx *sql.Tx) error {
+		var err error
+		counts, err = insertMessages(tx, page)
+		if err != nil {
+			return err
+		}
+
+		err = UpsertCheckpoint(tx, channelId, direction, cursor)
+		if err != nil {
+			return fmt.Errorf("error updating checkpoint: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return UpsertCounts{}, err
+	}
+
+	return counts, nil
+}
+
+// InsertMembers stores a page of guild members and their roles in a single transaction.
+func InsertMembers(db *sql.DB, members []*discordgo.Member) (UpsertCounts, error) {
+	var counts UpsertCounts
+
+	err := InTransaction(db, func(tx *sql.Tx) error {
+		for _, member := range members {
+			result, err := InsertMember(tx, member)
+			if err != nil {
+				return fmt.Errorf("error inserting member %s: %w", member.User.ID, err)
+			}
+			counts.Add(result)
+
+			err = ReplaceMemberRoles(tx, member)
+			if err != nil {
+				return fmt.Errorf("error inserting member roles: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return UpsertCounts{}, err
+	}
+
+	return counts, nil
+}
+
+// InsertChannels stores a set of channels and their forum tags in a single transaction.
+func InsertChannels(db *sql.DB, channels []*discordgo.Channel) (UpsertCounts, error) {
+	var counts UpsertCounts
+
+	err := InTransaction(db, func(tx *sql.Tx) error {
+		for _, channel := range channels {
+			result, err := InsertChannel(tx, channel)
+			if err != nil {
+				return fmt.Errorf("error inserting channel %s: %w", channel.ID, err)
+			}
+			counts.Add(result)
+
+			err = ReplaceForumTags(tx, channel)
+			if err != nil {
+				return fmt.Errorf("error inserting forum tags: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return UpsertCounts{}, err
+	}
+
+	return counts, nil
+}
+
+// ReplaceRoles stores the guild's roles in a single transaction, deleting any stored roles the guild no longer has.
+func ReplaceRoles(db *sql.DB, roles []*discordgo.Role) error {
+	return InTransaction(db, func(tx *sql.Tx) error {
+		roleIds := make([]string, len(roles))
+		for index, role := range roles {
+			err := InsertRole(tx, role)
+			if err != nil {
+				return fmt.Errorf("error inserting role %s: %w", role.ID, err)
+			}
+			roleIds[index] = role.ID
+		}
+
+		return PruneRoles(tx, roleIds)
+	})
+}
+
+// InsertEmojis stores a set of emoji in a single transaction.
+func InsertEmojis(db *sql.DB, emojis []*discordgo.Emoji) (UpsertCounts, error) {
+	var counts UpsertCounts
+
+	err := InTransaction(db, func(tx *sql.Tx) error {
+		for _, emoji := range emojis {
+			result, err := InsertEmoji(tx, emoji)
+			if err != nil {
+				return fmt.Errorf("error inserting emoji %s: %w", emoji.ID, err)
+			}
+			counts.Add(result)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return UpsertCounts{}, err
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nint8835/discordgo"
+	"github.com/rs/zerolog"
+
+	"github.com/nint8835/duckdbot/pkg/config"
+)
+
+const benchmarkPageSize = 100
+
+func openBenchmarkDb(b *testing.B) *sql.DB {
+	b.Helper()
+
+	// Migration logs would otherwise be interleaved with the benchmark results
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+
+	db, err := Open(&config.Config{DbPath: filepath.Join(b.TempDir(), "benchmark.duckdb")})
+	if err != nil {
+		b.Fatalf("error opening db: %s", err)
+	}
+	b.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+// benchmarkPage builds a page of messages with IDs that haven't been used by an earlier page, so every message is a
+// new insert. Messages only have reactions and mentions if withExtras is set.
+func benchmarkPage(page int, withExtras bool) MessagePage {
+	author := &discordgo.User{ID: "100000000000000000", Username: "benchmark"}
+
+	messages := make([]*discordgo.Message, benchmarkPageSize)
+	for index := range messages {
+		message := &discordgo.Message{
+			ID:        strconv.Itoa(200000000000000000 + page*benchmarkPageSize + index),
+			ChannelID: "300000000000000000",
+			Author:    author,
+			Content:   "benchmark message",
+			Timestamp: time.Now(),
+		}
+
+		if withExtras {
+			message.Reactions = []*discordgo.MessageReactions{
+				{Count: 1, Emoji: &discordgo.Emoji{Name: "👍"}},
+				{Count: 2, Emoji: &discordgo.Emoji{Name: "🦆"}},
+			}
+			message.Mentions = []*discordgo.User{author}
+			message.MentionRoles = []string{"400000000000000000"}
+		}
+
+		messages[index] = message
+	}
+
+	return MessagePage{Messages: messages}
+}
+
+// reportPerMessage reports the time taken per message alongside the default time per page.
+func reportPerMessage(b *testing.B) {
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*benchmarkPageSize), "ns/message")
+}
+
+func benchmarkInsertMessages(b *testing.B, withExtras bool) {
+	db := openBenchmarkDb(b)
+
+	b.ResetTimer()
+	for n := range b.N {
+		b.StopTimer()
+		page := benchmarkPage(n, withExtras)
+		b.StartTimer()
+
+		_, err := InsertMessages(db, page)
+		if err != nil {
+			b.Fatalf("error inserting messages: %s", err)
+		}
+	}
+
+	reportPerMessage(b)
+}
+
+func BenchmarkInsertMessages(b *testing.B) {
+	benchmarkInsertMessages(b, false)
+}
+
+func BenchmarkInsertMessagesWithExtras(b *testing.B) {
+	benchmarkInsertMessages(b, true)
+}
+
+// BenchmarkInsertMessagePerRow measures the original import path, which inserted each message on its own with no
+// revisions, reactions or mentions, as a baseline for InsertMessages.
+func BenchmarkInsertMessagePerRow(b *testing.B) {
+	db := openBenchmarkDb(b)
+
+	b.ResetTimer()
+	for n := range b.N {
+		b.StopTimer()
+		page := benchmarkPage(n, false)
+		b.StartTimer()
+
+		for _, message := range page.Messages {
+			err := InsertMessage(db, message)
+			if err != nil {
+				b.Fatalf("error inserting message: %s", err)
+			}
+		}
+	}
+
+	reportPerMessage(b)
+}
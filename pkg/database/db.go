@@ -5,16 +5,60 @@ import (
 	"fmt"
 
 	_ "github.com/marcboeker/go-duckdb"
+	"github.com/rs/zerolog/log"
 
 	"github.com/nint8835/duckdbot/pkg/config"
 )
 
+// Querier is implemented by both *sql.DB and *sql.Tx, allowing queries to be run either directly or within a transaction.
+type Querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// InTransaction runs fn within a transaction, committing it if fn succeeds and rolling it back otherwise.
+func InTransaction(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error beginning transaction: %w", err)
+	}
+
+	err = fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Connect opens the database without applying migrations or initializing any tables.
+func Connect(c *config.Config) (*sql.DB, error) {
+	return sql.Open("duckdb", c.DbPath)
+}
+
+// Open opens the database, applying any pending migrations.
 func Open(c *config.Config) (*sql.DB, error) {
-	db, err := sql.Open("duckdb", c.DbPath)
+	db, err := Connect(c)
 	if err != nil {
 		return nil, err
 	}
 
+	applied, err := Migrate(db)
+	if err != nil {
+		return nil, fmt.Errorf("error migrating db: %w", err)
+	}
+
+	for _, migration := range applied {
+		log.Info().Msgf("Applied migration %d_%s", migration.Version, migration.Name)
+	}
+
 	err = initDb(db)
 	if err != nil {
 		return nil, fmt.Errorf("error initializing db: %w", err)
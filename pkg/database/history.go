@@ -0,0 +1,206 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Users, channels and emoji are stored as history tables, where each row is one version of an entity.
+// The current version of an entity is the one with no valid_to, which is what the users, channels and emoji views expose.
+
+var userHistoryColumns = []string{
+	"username",
+	"display_name",
+	"is_bot",
+	"in_guild",
+	"joined_at",
+	"premium_since",
+	"timed_out_until",
+	"is_pending",
+	"avatar_url",
+}
+
+var channelHistoryColumns = []string{
+	"name",
+	"parent_id",
+	"type",
+	"visibility",
+	"topic",
+	"position",
+	"is_nsfw",
+	"rate_limit_per_user",
+	"created_at",
+	"owner_id",
+	"is_locked",
+}
+
+// channelUntrackedColumns change too often to be worth a new version each time, so they're updated on the current version instead.
+var channelUntrackedColumns = []string{
+	"is_archived",
+	"message_count",
+}
+
+var emojiHistoryColumns = []string{
+	"name",
+	"is_animated",
+}
+
+// upsertHistory records the given state of an entity in a history table. If the entity's current version differs
+// from the given values it is closed and a new version is inserted, otherwise the table is left unchanged.
+// Untracked columns are stored on the current version without being compared, so changes to them never create a new version.
+func upsertHistory(
+	db Querier,
+	table string,
+	id string,
+	columns []string,
+	values []any,
+	untrackedColumns []string,
+	untrackedValues []any,
+) (UpsertResult, error) {
+	changedConditions := make([]string, len(columns))
+	for i, column := range columns {
+		changedConditions[i] = fmt.Sprintf("%s IS DISTINCT FROM $%d", column, i+2)
+	}
+
+	args := append([]any{id}, values...)
+
+	closeResult, err := db.Exec(
+		fmt.Sprintf(
+			"UPDATE %s SET valid_to = now() WHERE id = $1 AND valid_to IS NULL AND (%s)",
+			table,
+			strings.Join(changedConditions, " OR "),
+		),
+		args...,
+	)
+	if err != nil {
+		return UpsertUnchanged, fmt.Errorf("error closing previous version: %w", err)
+	}
+
+	closedCount, err := closeResult.RowsAffected()
+	if err != nil {
+		return UpsertUnchanged, fmt.Errorf("error getting closed version count: %w", err)
+	}
+
+	var hasCurrentVersion bool
+	err = db.QueryRow(
+		fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE id = $1 AND valid_to IS NULL)", table),
+		id,
+	).Scan(&hasCurrentVersion)
+	if err != nil {
+		return UpsertUnchanged, fmt.Errorf("error checking for current version: %w", err)
+	}
+
+	if hasCurrentVersion {
+		if len(untrackedColumns) == 0 {
+			return UpsertUnchanged, nil
+		}
+
+		assignments := make([]string, len(untrackedColumns))
+		for i, column := range untrackedColumns {
+			assignments[i] = fmt.Sprintf("%s = $%d", column, i+2)
+		}
+
+		_, err = db.Exec(
+			fmt.Sprintf("UPDATE %s SET %s WHERE id = $1 AND valid_to IS NULL", table, strings.Join(assignments, ", ")),
+			append([]any{id}, untrackedValues...)...,
+		)
+		if err != nil {
+			return UpsertUnchanged, fmt.Errorf("error updating current version: %w", err)
+		}
+
+		return UpsertUnchanged, nil
+	}
+
+	insertColumns := append(slices.Clone(columns), untrackedColumns...)
+	placeholders := make([]string, len(insertColumns))
+	for i := range insertColumns {
+		placeholders[i] = fmt.Sprintf("$%d", i+2)
+	}
+
+	_, err = db.Exec(
+		fmt.Sprintf(
+			"INSERT INTO %s (id, %s, valid_from) VALUES ($1, %s, now())",
+			table,
+			strings.Join(insertColumns, ", "),
+			strings.Join(placeholders, ", "),
+		),
+		append(args, untrackedValues...)...,
+	)
+	if err != nil {
+		return UpsertUnchanged, fmt.Errorf("error inserting new version: %w", err)
+	}
+
+	if closedCount > 0 {
+		return UpsertUpdated, nil
+	}
+
+	return UpsertInserted, nil
+}
+
+// closeHistory closes the current version of an entity in a history table, so it no longer appears in its view.
+func closeHistory(db Querier, table string, id string) error {
+	_, err := db.Exec(
+		fmt.Sprintf("UPDATE %s SET valid_to = now() WHERE id = $1 AND valid_to IS NULL", table),
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MarkMemberDeparted records that a user is no longer a member of the guild, by replacing their current version
+// with one that has no member details.
+func MarkMemberDeparted(db Querier, userId string) error {
+	_, err := db.Exec(
+		`INSERT INTO users_history (id, username, display_name, is_bot, in_guild, avatar_url, valid_from)
+		SELECT id, username, display_name, is_bot, false, avatar_url, now()
+		FROM users_history
+		WHERE id = $1 AND valid_to IS NULL AND in_guild`,
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("error inserting departed version: %w", err)
+	}
+
+	_, err = db.Exec(
+		"UPDATE users_history SET valid_to = now() WHERE id = $1 AND valid_to IS NULL AND in_guild",
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("error closing member version: %w", err)
+	}
+
+	_, err = db.Exec("DELETE FROM member_roles WHERE user_id = $1", userId)
+	if err != nil {
+		return fmt.Errorf("error deleting member roles: %w", err)
+	}
+
+	return nil
+}
+
+func MarkChannelDeleted(db Querier, channelId string) error {
+	return closeHistory(db, "channels_history", channelId)
+}
+
+func MarkEmojiDeleted(db Querier, emojiId string) error {
+	return closeHistory(db, "emoji_history", emojiId)
+}
+
+// UpdateChannelAccess records whether the bot can read a channel on its current version. An empty skipReason means the
+// channel is accessible. Access isn't tracked as part of a channel's history, so this doesn't create a new version.
+func UpdateChannelAccess(db Querier, channelId string, skipReason string) error {
+	_, err := db.Exec(
+		"UPDATE channels_history SET accessible = $2, skip_reason = $3 WHERE id = $1 AND valid_to IS NULL",
+		channelId,
+		skipReason == "",
+		nullString(skipReason),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -2,20 +2,106 @@ package database
 
 import (
 	"cmp"
-	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/nint8835/discordgo"
 )
 
-func InsertMessage(db *sql.DB, message *discordgo.Message) error {
-	_, err := db.Exec(
-		"INSERT INTO messages (id, channel_id, author_id, content, time_sent) VALUES ($1, $2, $3, $4, $5)",
+// UpsertResult describes how an upsert changed the stored state of an entity.
+type UpsertResult int
+
+const (
+	UpsertUnchanged UpsertResult = iota
+	UpsertInserted
+	UpsertUpdated
+)
+
+// UpsertCounts tallies how many entities a set of upserts inserted and updated.
+type UpsertCounts struct {
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated"`
+}
+
+func (c *UpsertCounts) Add(result UpsertResult) {
+	switch result {
+	case UpsertInserted:
+		c.Inserted++
+	case UpsertUpdated:
+		c.Updated++
+	}
+}
+
+func (c *UpsertCounts) Merge(other UpsertCounts) {
+	c.Inserted += other.Inserted
+	c.Updated += other.Updated
+}
+
+// messageReferenceType describes why a message references another message, or returns nil if it does not.
+func messageReferenceType(message *discordgo.Message) *string {
+	if message.MessageReference == nil {
+		return nil
+	}
+
+	var referenceType string
+	switch {
+	case message.MessageReference.Type == discordgo.MessageReferenceTypeForward:
+		referenceType = "forward"
+	case message.Type == discordgo.MessageTypeReply:
+		referenceType = "reply"
+	case message.Flags&discordgo.MessageFlagsIsCrossPosted != 0:
+		referenceType = "crosspost"
+	case message.Type == discordgo.MessageTypeChannelPinnedMessage:
+		referenceType = "pin"
+	case message.Type == discordgo.MessageTypeThreadStarterMessage:
+		referenceType = "thread_starter"
+	default:
+		referenceType = "other"
+	}
+
+	return &referenceType
+}
+
+// messageColumns are the columns messageValues returns values for, in order.
+const messageColumns = "id, channel_id, author_id, content, time_sent, edited_at, referenced_message_id, referenced_channel_id, reference_type, is_pinned"
+
+func messageValues(message *discordgo.Message) []any {
+	var referencedMessageId, referencedChannelId *string
+	if message.MessageReference != nil {
+		referencedMessageId = nullString(message.MessageReference.MessageID)
+		referencedChannelId = nullString(message.MessageReference.ChannelID)
+	}
+
+	return []any{
 		message.ID,
 		message.ChannelID,
 		message.Author.ID,
 		message.Content,
 		message.Timestamp,
+		message.EditedTimestamp,
+		referencedMessageId,
+		referencedChannelId,
+		messageReferenceType(message),
+		message.Pinned,
+	}
+}
+
+const messageConflictClause = `ON CONFLICT (id) DO UPDATE SET
+	content = excluded.content,
+	edited_at = excluded.edited_at,
+	is_pinned = excluded.is_pinned`
+
+func InsertMessage(db Querier, message *discordgo.Message) error {
+	_, err := db.Exec(
+		fmt.Sprintf(
+			"INSERT INTO messages (%s) VALUES %s %s",
+			messageColumns,
+			valuesPlaceholders(1, 10),
+			messageConflictClause,
+		),
+		messageValues(message)...,
 	)
 	if err != nil {
 		return err
@@ -24,14 +110,10 @@ func InsertMessage(db *sql.DB, message *discordgo.Message) error {
 	return nil
 }
 
-func InsertUser(db *sql.DB, user *discordgo.User) error {
+func MarkMessageDeleted(db Querier, messageId string) error {
 	_, err := db.Exec(
-		"INSERT INTO users (id, username, display_name, in_guild, is_bot) VALUES ($1, $2, $3, $4, $5)",
-		user.ID,
-		user.Username,
-		cmp.Or(user.GlobalName, user.Username),
-		false,
-		user.Bot,
+		"UPDATE messages SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL",
+		messageId,
 	)
 	if err != nil {
 		return err
@@ -40,14 +122,121 @@ func InsertUser(db *sql.DB, user *discordgo.User) error {
 	return nil
 }
 
-func InsertMember(db *sql.DB, user *discordgo.Member) error {
-	_, err := db.Exec(
-		"INSERT INTO users (id, username, display_name, in_guild, is_bot) VALUES ($1, $2, $3, $4, $5)",
-		user.User.ID,
-		user.User.Username,
-		cmp.Or(user.Nick, user.User.GlobalName, user.User.Username),
-		true,
-		user.User.Bot,
+// UpsertMessages inserts or updates a page of messages with a single statement.
+// If a message has been edited since it was last stored, its previous content is kept in the message_revisions table.
+func UpsertMessages(db Querier, messages []*discordgo.Message) (UpsertCounts, error) {
+	var counts UpsertCounts
+	if len(messages) == 0 {
+		return counts, nil
+	}
+
+	stored, err := GetStoredMessages(db, messageIds(messages))
+	if err != nil {
+		return counts, fmt.Errorf("error getting stored messages: %w", err)
+	}
+
+	var revisionArgs []any
+	var messageArgs []any
+	for _, message := range messages {
+		previous := stored[message.ID]
+		if previous == nil {
+			counts.Add(UpsertInserted)
+		} else if previous.Content != message.Content || !timesEqual(previous.EditedAt, message.EditedTimestamp) {
+			revisionArgs = append(revisionArgs, previous.Id, previous.Content, previous.EditedAt)
+			counts.Add(UpsertUpdated)
+		}
+
+		messageArgs = append(messageArgs, messageValues(message)...)
+	}
+
+	if len(revisionArgs) > 0 {
+		_, err = db.Exec(
+			"INSERT INTO message_revisions (message_id, content, edited_at) VALUES "+valuesPlaceholders(len(revisionArgs)/3, 3),
+			revisionArgs...,
+		)
+		if err != nil {
+			return UpsertCounts{}, fmt.Errorf("error inserting message revisions: %w", err)
+		}
+	}
+
+	_, err = db.Exec(
+		fmt.Sprintf(
+			"INSERT INTO messages (%s) VALUES %s %s",
+			messageColumns,
+			valuesPlaceholders(len(messages), 10),
+			messageConflictClause,
+		),
+		messageArgs...,
+	)
+	if err != nil {
+		return UpsertCounts{}, err
+	}
+
+	return counts, nil
+}
+
+// ReplaceAttachments replaces all stored attachments for a page of messages, as editing a message can remove attachments.
+// Attachments that are still present are updated rather than deleted and reinserted, as DuckDB rejects reinserting a
+// key deleted earlier in the same transaction.
+func ReplaceAttachments(db Querier, messages []*discordgo.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	var attachmentIds []any
+	var attachmentArgs []any
+	for _, message := range messages {
+		for _, attachment := range message.Attachments {
+			var width, height *int
+			if attachment.Width != 0 || attachment.Height != 0 {
+				width = &attachment.Width
+				height = &attachment.Height
+			}
+
+			attachmentIds = append(attachmentIds, attachment.ID)
+			attachmentArgs = append(
+				attachmentArgs,
+				attachment.ID,
+				message.ID,
+				attachment.Filename,
+				nullString(attachment.ContentType),
+				attachment.Size,
+				width,
+				height,
+				attachment.URL,
+				strings.HasPrefix(attachment.Filename, "SPOILER_"),
+			)
+		}
+	}
+
+	ids := anySlice(messageIds(messages))
+	query := fmt.Sprintf("DELETE FROM attachments WHERE message_id IN %s", inPlaceholders(1, len(ids)))
+	if len(attachmentIds) > 0 {
+		query += " AND id NOT IN " + inPlaceholders(len(ids)+1, len(attachmentIds))
+	}
+
+	_, err := db.Exec(query, append(ids, attachmentIds...)...)
+	if err != nil {
+		return fmt.Errorf("error deleting removed attachments: %w", err)
+	}
+
+	if len(attachmentIds) == 0 {
+		return nil
+	}
+
+	_, err = db.Exec(
+		`INSERT INTO attachments (id, message_id, filename, content_type, size, width, height, url, is_spoiler)
+		VALUES `+valuesPlaceholders(len(attachmentIds), 9)+`
+		ON CONFLICT (id) DO UPDATE SET
+			message_id = excluded.message_id,
+			filename = excluded.filename,
+			content_type = excluded.content_type,
+			size = excluded.size,
+			width = excluded.width,
+			height = excluded.height,
+			url = excluded.url,
+			is_spoiler = excluded.is_spoiler`,
+		attachmentArgs...,
 	)
 	if err != nil {
 		return err
@@ -56,12 +245,52 @@ func InsertMember(db *sql.DB, user *discordgo.Member) error {
 	return nil
 }
 
-func InsertChannel(db *sql.DB, channel *discordgo.Channel) error {
-	_, err := db.Exec(
-		"INSERT INTO channels (id, name, parent_id) VALUES ($1, $2, $3)",
-		channel.ID,
-		channel.Name,
-		nil,
+// ReplaceReactions replaces all stored reactions for a page of messages, as reaction counts change over time.
+func ReplaceReactions(db Querier, page MessagePage) error {
+	if len(page.Messages) == 0 {
+		return nil
+	}
+
+	var reactionArgs []any
+	for _, message := range page.Messages {
+		burstCounts := page.ReactionBurstCounts[message.ID]
+
+		for index, reaction := range message.Reactions {
+			if reaction.Emoji == nil {
+				continue
+			}
+
+			burstCount := 0
+			if index < len(burstCounts) {
+				burstCount = burstCounts[index]
+			}
+
+			reactionArgs = append(
+				reactionArgs,
+				message.ID,
+				nullString(reaction.Emoji.ID),
+				reaction.Emoji.Name,
+				reaction.Emoji.Animated,
+				reaction.Count,
+				burstCount,
+			)
+		}
+	}
+
+	ids := anySlice(messageIds(page.Messages))
+	_, err := db.Exec("DELETE FROM reactions WHERE message_id IN "+inPlaceholders(1, len(ids)), ids...)
+	if err != nil {
+		return fmt.Errorf("error deleting existing reactions: %w", err)
+	}
+
+	if len(reactionArgs) == 0 {
+		return nil
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO reactions (message_id, emoji_id, emoji_name, is_animated, count, burst_count) VALUES "+
+			valuesPlaceholders(len(reactionArgs)/6, 6),
+		reactionArgs...,
 	)
 	if err != nil {
 		return err
@@ -70,12 +299,194 @@ func InsertChannel(db *sql.DB, channel *discordgo.Channel) error {
 	return nil
 }
 
-func InsertThread(db *sql.DB, thread *discordgo.Channel) error {
-	_, err := db.Exec(
-		"INSERT INTO channels (id, name, parent_id) VALUES ($1, $2, $3)",
-		thread.ID,
+// ReplaceMentions replaces all stored mentions for a page of messages, as editing a message can change who it mentions.
+func ReplaceMentions(db Querier, messages []*discordgo.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	var mentionArgs []any
+	addMention := func(messageId string, kind string, targetId *string) {
+		mentionArgs = append(mentionArgs, messageId, kind, targetId)
+	}
+
+	for _, message := range messages {
+		for _, user := range message.Mentions {
+			addMention(message.ID, "user", &user.ID)
+		}
+
+		for _, roleId := range message.MentionRoles {
+			addMention(message.ID, "role", &roleId)
+		}
+
+		for _, channel := range message.MentionChannels {
+			addMention(message.ID, "channel", &channel.ID)
+		}
+
+		if message.MentionEveryone {
+			addMention(message.ID, "everyone", nil)
+		}
+	}
+
+	ids := anySlice(messageIds(messages))
+	_, err := db.Exec("DELETE FROM message_mentions WHERE message_id IN "+inPlaceholders(1, len(ids)), ids...)
+	if err != nil {
+		return fmt.Errorf("error deleting existing mentions: %w", err)
+	}
+
+	if len(mentionArgs) == 0 {
+		return nil
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO message_mentions (message_id, kind, target_id) VALUES "+valuesPlaceholders(len(mentionArgs)/3, 3),
+		mentionArgs...,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InsertUser records a user who is not a member of the guild.
+func InsertUser(db Querier, user *discordgo.User) (UpsertResult, error) {
+	return upsertHistory(db, "users_history", user.ID, userHistoryColumns, []any{
+		user.Username,
+		cmp.Or(user.GlobalName, user.Username),
+		user.Bot,
+		false,
+		nil,
+		nil,
+		nil,
+		nil,
+		nil,
+	}, nil, nil)
+}
+
+func InsertMember(db Querier, user *discordgo.Member) (UpsertResult, error) {
+	return upsertHistory(db, "users_history", user.User.ID, userHistoryColumns, []any{
+		user.User.Username,
+		cmp.Or(user.Nick, user.User.GlobalName, user.User.Username),
+		user.User.Bot,
+		true,
+		user.JoinedAt,
+		user.PremiumSince,
+		user.CommunicationDisabledUntil,
+		user.Pending,
+		user.AvatarURL(""),
+	}, nil, nil)
+}
+
+// channelTypeName returns a human-readable name for a channel type.
+func channelTypeName(channelType discordgo.ChannelType) string {
+	switch channelType {
+	case discordgo.ChannelTypeGuildText:
+		return "text"
+	case discordgo.ChannelTypeDM:
+		return "dm"
+	case discordgo.ChannelTypeGuildVoice:
+		return "voice"
+	case discordgo.ChannelTypeGroupDM:
+		return "group_dm"
+	case discordgo.ChannelTypeGuildCategory:
+		return "category"
+	case discordgo.ChannelTypeGuildNews:
+		return "announcement"
+	case discordgo.ChannelTypeGuildStore:
+		return "store"
+	case discordgo.ChannelTypeGuildNewsThread:
+		return "announcement_thread"
+	case discordgo.ChannelTypeGuildPublicThread:
+		return "public_thread"
+	case discordgo.ChannelTypeGuildPrivateThread:
+		return "private_thread"
+	case discordgo.ChannelTypeGuildStageVoice:
+		return "stage_voice"
+	case discordgo.ChannelTypeGuildDirectory:
+		return "directory"
+	case discordgo.ChannelTypeGuildForum:
+		return "forum"
+	case discordgo.ChannelTypeGuildMedia:
+		return "media"
+	default:
+		return fmt.Sprintf("unknown_%d", channelType)
+	}
+}
+
+func InsertChannel(db Querier, channel *discordgo.Channel) (UpsertResult, error) {
+	createdAt, err := discordgo.SnowflakeTimestamp(channel.ID)
+	if err != nil {
+		return UpsertUnchanged, fmt.Errorf("error getting channel creation time: %w", err)
+	}
+
+	return upsertHistory(db, "channels_history", channel.ID, channelHistoryColumns, []any{
+		channel.Name,
+		nullString(channel.ParentID),
+		channelTypeName(channel.Type),
+		"public",
+		nullString(channel.Topic),
+		channel.Position,
+		channel.NSFW,
+		channel.RateLimitPerUser,
+		createdAt,
+		nil,
+		nil,
+	}, channelUntrackedColumns, []any{
+		nil,
+		nil,
+	})
+}
+
+func InsertThread(db Querier, thread *discordgo.Channel) (UpsertResult, error) {
+	createdAt, err := discordgo.SnowflakeTimestamp(thread.ID)
+	if err != nil {
+		return UpsertUnchanged, fmt.Errorf("error getting thread creation time: %w", err)
+	}
+
+	var isArchived, isLocked *bool
+	if thread.ThreadMetadata != nil {
+		isArchived = &thread.ThreadMetadata.Archived
+		isLocked = &thread.ThreadMetadata.Locked
+	}
+
+	visibility := "public"
+	if thread.Type == discordgo.ChannelTypeGuildPrivateThread {
+		visibility = "private"
+	}
+
+	return upsertHistory(db, "channels_history", thread.ID, channelHistoryColumns, []any{
 		thread.Name,
 		thread.ParentID,
+		channelTypeName(thread.Type),
+		visibility,
+		nullString(thread.Topic),
+		thread.Position,
+		thread.NSFW,
+		thread.RateLimitPerUser,
+		createdAt,
+		nullString(thread.OwnerID),
+		isLocked,
+	}, channelUntrackedColumns, []any{
+		isArchived,
+		thread.MessageCount,
+	})
+}
+
+func InsertForumTag(db Querier, channelId string, tag *discordgo.ForumTag) error {
+	_, err := db.Exec(
+		`INSERT INTO forum_tags (id, channel_id, name, is_moderated, emoji_id, emoji_name) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name,
+			is_moderated = excluded.is_moderated,
+			emoji_id = excluded.emoji_id,
+			emoji_name = excluded.emoji_name`,
+		tag.ID,
+		channelId,
+		tag.Name,
+		tag.Moderated,
+		nullString(tag.EmojiID),
+		nullString(tag.EmojiName),
 	)
 	if err != nil {
 		return err
@@ -84,12 +495,80 @@ func InsertThread(db *sql.DB, thread *discordgo.Channel) error {
 	return nil
 }
 
-func InsertEmoji(db *sql.DB, emoji *discordgo.Emoji) error {
+// ReplaceForumTags replaces all stored tags for a forum channel, as tags can be removed from a forum.
+func ReplaceForumTags(db Querier, channel *discordgo.Channel) error {
+	_, err := db.Exec("DELETE FROM forum_tags WHERE channel_id = $1", channel.ID)
+	if err != nil {
+		return fmt.Errorf("error deleting existing forum tags: %w", err)
+	}
+
+	for _, tag := range channel.AvailableTags {
+		err = InsertForumTag(db, channel.ID, &tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func InsertThreadTag(db Querier, threadId string, tagId string) error {
 	_, err := db.Exec(
-		"INSERT INTO emoji (id, name, is_animated) VALUES ($1, $2, $3)",
-		emoji.ID,
+		"INSERT INTO thread_tags (thread_id, tag_id) VALUES ($1, $2) ON CONFLICT (thread_id, tag_id) DO NOTHING",
+		threadId,
+		tagId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReplaceThreadTags replaces all stored tags for a thread, as a thread's applied tags can change.
+func ReplaceThreadTags(db Querier, thread *discordgo.Channel) error {
+	_, err := db.Exec("DELETE FROM thread_tags WHERE thread_id = $1", thread.ID)
+	if err != nil {
+		return fmt.Errorf("error deleting existing thread tags: %w", err)
+	}
+
+	for _, tagId := range thread.AppliedTags {
+		err = InsertThreadTag(db, thread.ID, tagId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func InsertEmoji(db Querier, emoji *discordgo.Emoji) (UpsertResult, error) {
+	return upsertHistory(db, "emoji_history", emoji.ID, emojiHistoryColumns, []any{
 		emoji.Name,
 		emoji.Animated,
+	}, nil, nil)
+}
+
+func InsertRole(db Querier, role *discordgo.Role) error {
+	_, err := db.Exec(
+		`INSERT INTO roles (id, name, color, position, permissions, is_hoisted, is_managed, is_mentionable)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name,
+			color = excluded.color,
+			position = excluded.position,
+			permissions = excluded.permissions,
+			is_hoisted = excluded.is_hoisted,
+			is_managed = excluded.is_managed,
+			is_mentionable = excluded.is_mentionable`,
+		role.ID,
+		role.Name,
+		role.Color,
+		role.Position,
+		role.Permissions,
+		role.Hoist,
+		role.Managed,
+		role.Mentionable,
 	)
 	if err != nil {
 		return err
@@ -98,28 +577,34 @@ func InsertEmoji(db *sql.DB, emoji *discordgo.Emoji) error {
 	return nil
 }
 
-func InsertCachedUser(db *sql.DB, user *discordgo.User) error {
+// PruneRoles deletes every stored role not in roleIds, along with any member's assignment of them.
+func PruneRoles(db Querier, roleIds []string) error {
+	condition := ""
+	if len(roleIds) > 0 {
+		condition = " WHERE id NOT IN " + inPlaceholders(1, len(roleIds))
+	}
+
 	_, err := db.Exec(
-		"INSERT INTO _user_cache (id, username, display_name, is_bot, cached_at) VALUES ($1, $2, $3, $4, now())",
-		user.ID,
-		user.Username,
-		user.GlobalName,
-		user.Bot,
+		"DELETE FROM member_roles WHERE role_id IN (SELECT id FROM roles"+condition+")",
+		anySlice(roleIds)...,
 	)
 	if err != nil {
-		return err
+		return fmt.Errorf("error deleting removed member roles: %w", err)
+	}
+
+	_, err = db.Exec("DELETE FROM roles"+condition, anySlice(roleIds)...)
+	if err != nil {
+		return fmt.Errorf("error deleting removed roles: %w", err)
 	}
 
 	return nil
 }
 
-func UpdateCachedUser(db *sql.DB, user *discordgo.User) error {
+func InsertMemberRole(db Querier, userId string, roleId string) error {
 	_, err := db.Exec(
-		"UPDATE _user_cache SET username = $2, display_name = $3, is_bot = $4, cached_at = now() WHERE id = $1",
-		user.ID,
-		user.Username,
-		user.GlobalName,
-		user.Bot,
+		"INSERT INTO member_roles (user_id, role_id) VALUES ($1, $2) ON CONFLICT (user_id, role_id) DO NOTHING",
+		userId,
+		roleId,
 	)
 	if err != nil {
 		return err
@@ -128,23 +613,43 @@ func UpdateCachedUser(db *sql.DB, user *discordgo.User) error {
 	return nil
 }
 
-func UpsertCachedUser(db *sql.DB, user *discordgo.User) error {
-	cached, err := GetCachedUser(db, user.ID)
+// ReplaceMemberRoles replaces all stored roles for a member, as roles can be removed from a member.
+// Roles the member still has are kept rather than deleted and reinserted, as DuckDB rejects reinserting a key deleted
+// earlier in the same transaction.
+func ReplaceMemberRoles(db Querier, member *discordgo.Member) error {
+	query := "DELETE FROM member_roles WHERE user_id = $1"
+	if len(member.Roles) > 0 {
+		query += " AND role_id NOT IN " + inPlaceholders(2, len(member.Roles))
+	}
+
+	_, err := db.Exec(query, append([]any{member.User.ID}, anySlice(member.Roles)...)...)
 	if err != nil {
-		return fmt.Errorf("error getting cached user: %w", err)
+		return fmt.Errorf("error deleting removed member roles: %w", err)
 	}
 
-	if cached == nil {
-		return InsertCachedUser(db, user)
+	for _, roleId := range member.Roles {
+		err = InsertMemberRole(db, member.User.ID, roleId)
+		if err != nil {
+			return err
+		}
 	}
 
-	return UpdateCachedUser(db, user)
+	return nil
 }
 
-func InsertInvalidCachedUser(db *sql.DB, userId string) error {
+const (
+	CheckpointDirectionNewer = "newer"
+	CheckpointDirectionOlder = "older"
+)
+
+// UpsertCheckpoint records how far an import of a channel has progressed in the given direction.
+func UpsertCheckpoint(db Querier, channelId string, direction string, cursor string) error {
 	_, err := db.Exec(
-		"INSERT INTO _invalid_user_cache (id, cached_at) VALUES ($1, now())",
-		userId,
+		`INSERT INTO import_checkpoints (channel_id, direction, cursor, completed, updated_at) VALUES ($1, $2, $3, false, now())
+		ON CONFLICT (channel_id, direction) DO UPDATE SET cursor = excluded.cursor, completed = false, updated_at = now()`,
+		channelId,
+		direction,
+		cursor,
 	)
 	if err != nil {
 		return err
@@ -153,10 +658,15 @@ func InsertInvalidCachedUser(db *sql.DB, userId string) error {
 	return nil
 }
 
-func UpdateInvalidCachedUser(db *sql.DB, userId string) error {
+// CompleteCheckpoint marks an import of a channel in the given direction as having reached the end of the channel's history.
+// The cursor is only used if no checkpoint has been recorded yet.
+func CompleteCheckpoint(db Querier, channelId string, direction string, cursor string) error {
 	_, err := db.Exec(
-		"UPDATE _invalid_user_cache SET cached_at = now() WHERE id = $1",
-		userId,
+		`INSERT INTO import_checkpoints (channel_id, direction, cursor, completed, updated_at) VALUES ($1, $2, $3, true, now())
+		ON CONFLICT (channel_id, direction) DO UPDATE SET completed = true, updated_at = now()`,
+		channelId,
+		direction,
+		cursor,
 	)
 	if err != nil {
 		return err
@@ -165,24 +675,98 @@ func UpdateInvalidCachedUser(db *sql.DB, userId string) error {
 	return nil
 }
 
-func UpsertInvalidCachedUser(db *sql.DB, userId string) error {
-	var exists bool
-	err := db.QueryRow(
-		"SELECT EXISTS(SELECT 1 FROM _invalid_user_cache WHERE id = $1)",
-		userId,
-	).Scan(&exists)
+const (
+	RunStatusRunning   = "running"
+	RunStatusSucceeded = "succeeded"
+	RunStatusFailed    = "failed"
+	RunStatusCancelled = "cancelled"
+)
+
+// StartImportRun records the start of an import run with the given config, returning the run's ID.
+func StartImportRun(db Querier, config any) (int64, error) {
+	configJson, err := json.Marshal(config)
+	if err != nil {
+		return 0, fmt.Errorf("error marshalling config: %w", err)
+	}
+
+	var runId int64
+	err = db.QueryRow(
+		"INSERT INTO import_runs (started_at, config, status) VALUES (now(), $1, $2) RETURNING id",
+		string(configJson),
+		RunStatusRunning,
+	).Scan(&runId)
+	if err != nil {
+		return 0, err
+	}
+
+	return runId, nil
+}
+
+// FinishImportRun records the outcome of an import run.
+func FinishImportRun(db Querier, runId int64, status string, counts map[string]UpsertCounts, errors []string) error {
+	countsJson, err := json.Marshal(counts)
+	if err != nil {
+		return fmt.Errorf("error marshalling counts: %w", err)
+	}
+
+	errorsJson, err := json.Marshal(errors)
+	if err != nil {
+		return fmt.Errorf("error marshalling errors: %w", err)
+	}
+
+	_, err = db.Exec(
+		"UPDATE import_runs SET finished_at = now(), status = $2, counts = $3, errors = $4 WHERE id = $1",
+		runId,
+		status,
+		string(countsJson),
+		string(errorsJson),
+	)
 	if err != nil {
-		return fmt.Errorf("error checking if invalid cached user exists: %w", err)
+		return err
 	}
 
-	if !exists {
-		return InsertInvalidCachedUser(db, userId)
+	return nil
+}
+
+// UpsertCachedUser caches a user's details, replacing any existing entry for them.
+func UpsertCachedUser(db Querier, user *discordgo.User) error {
+	_, err := db.Exec(
+		`INSERT INTO _user_cache (id, username, display_name, is_bot, cached_at)
+		VALUES ($1, $2, $3, $4, now())
+		ON CONFLICT (id) DO UPDATE SET
+			username = excluded.username,
+			display_name = excluded.display_name,
+			is_bot = excluded.is_bot,
+			cached_at = excluded.cached_at`,
+		user.ID,
+		user.Username,
+		user.GlobalName,
+		user.Bot,
+	)
+	if err != nil {
+		return err
 	}
 
-	return UpdateInvalidCachedUser(db, userId)
+	return nil
 }
 
-func DeleteInvalidCachedUser(db *sql.DB, userId string) error {
+// UpsertInvalidCachedUser records that a user can't be fetched, refreshing the entry if they were already recorded.
+func UpsertInvalidCachedUser(db Querier, userId string) error {
+	_, err := db.Exec(
+		`INSERT INTO _invalid_user_cache (id, cached_at)
+		VALUES ($1, now())
+		ON CONFLICT (id) DO UPDATE SET
+			cached_at = excluded.cached_at`,
+		userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func DeleteInvalidCachedUser(db Querier, userId string) error {
 	_, err := db.Exec(
 		"DELETE FROM _invalid_user_cache WHERE id = $1",
 		userId,
@@ -193,3 +777,62 @@ func DeleteInvalidCachedUser(db *sql.DB, userId string) error {
 
 	return nil
 }
+
+// valuesPlaceholders returns the placeholders for a multi-row VALUES list, numbered from $1, such as "($1, $2), ($3, $4)".
+func valuesPlaceholders(rowCount int, columnCount int) string {
+	rows := make([]string, rowCount)
+	placeholders := make([]string, columnCount)
+	for row := range rowCount {
+		for column := range columnCount {
+			placeholders[column] = fmt.Sprintf("$%d", row*columnCount+column+1)
+		}
+		rows[row] = "(" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	return strings.Join(rows, ", ")
+}
+
+// inPlaceholders returns the placeholders for an IN list of count values, numbered from $start, such as "($1, $2)".
+func inPlaceholders(start int, count int) string {
+	placeholders := make([]string, count)
+	for i := range count {
+		placeholders[i] = fmt.Sprintf("$%d", start+i)
+	}
+
+	return "(" + strings.Join(placeholders, ", ") + ")"
+}
+
+func messageIds(messages []*discordgo.Message) []string {
+	ids := make([]string, len(messages))
+	for i, message := range messages {
+		ids[i] = message.ID
+	}
+
+	return ids
+}
+
+func anySlice[T any](values []T) []any {
+	result := make([]any, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+
+	return result
+}
+
+func nullString(value string) *string {
+	if value == "" {
+		return nil
+	}
+
+	return &value
+}
+
+func timesEqual(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	// DuckDB stores timestamps with microsecond precision
+	return a.Truncate(time.Microsecond).Equal(b.Truncate(time.Microsecond))
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var schemaVersionTableQuery = `CREATE TABLE IF NOT EXISTS schema_version (
+	version integer NOT NULL,
+	name varchar NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT schema_version_pk PRIMARY KEY (version)
+);`
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+}
+
+// goMigrations contains migrations that can't be expressed as plain SQL.
+// Their versions share a sequence with the SQL migrations in the migrations directory.
+var goMigrations = []Migration{}
+
+func sqlMigration(query string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+// Migrations returns all known migrations, ordered by version.
+func Migrations() ([]Migration, error) {
+	migrations := slices.Clone(goMigrations)
+
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	for _, entry := range entries {
+		// Migration files are named like 0001_initial.sql
+		versionStr, name, found := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), "_")
+		if !found {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+
+		query, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %w", entry.Name(), err)
+		}
+
+		migrations = append(migrations, Migration{Version: version, Name: name, Up: sqlMigration(string(query))})
+	}
+
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return a.Version - b.Version
+	})
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// getAppliedMigrations returns when each applied migration was applied, keyed by version.
+// A database without a schema version table has had no migrations applied, and is left unmodified.
+func getAppliedMigrations(db *sql.DB) (map[int]time.Time, error) {
+	appliedAt := map[int]time.Time{}
+
+	var exists bool
+	err := db.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM duckdb_tables() WHERE schema_name = 'main' AND table_name = 'schema_version')",
+	).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("error checking for schema version table: %w", err)
+	}
+
+	if !exists {
+		return appliedAt, nil
+	}
+
+	rows, err := db.Query(`SELECT version, applied_at FROM main.schema_version`)
+	if err != nil {
+		return nil, fmt.Errorf("error getting applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var applied time.Time
+		err = rows.Scan(&version, &applied)
+		if err != nil {
+			return nil, err
+		}
+		appliedAt[version] = applied
+	}
+
+	return appliedAt, rows.Err()
+}
+
+// GetMigrationStatuses returns every known migration along with when it was applied, if it has been.
+func GetMigrationStatuses(db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	appliedAt, err := getAppliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Migration: migration}
+		if applied, ok := appliedAt[migration.Version]; ok {
+			status.AppliedAt = &applied
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// GetPendingMigrations returns all migrations which have not yet been applied, ordered by version.
+func GetPendingMigrations(db *sql.DB) ([]Migration, error) {
+	statuses, err := GetMigrationStatuses(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, status.Migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// Migrate applies all pending migrations in order, each in its own transaction, returning the migrations that were applied.
+func Migrate(db *sql.DB) ([]Migration, error) {
+	_, err := db.Exec(schemaVersionTableQuery)
+	if err != nil {
+		return nil, fmt.Errorf("error creating schema version table: %w", err)
+	}
+
+	pending, err := GetPendingMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range pending {
+		err = InTransaction(db, func(tx *sql.Tx) error {
+			err := migration.Up(tx)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(
+				"INSERT INTO schema_version (version, name, applied_at) VALUES ($1, $2, now())",
+				migration.Version,
+				migration.Name,
+			)
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("error applying migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
@@ -0,0 +1,94 @@
+-- Baseline schema. Databases created before migrations were introduced may already contain some or all of these
+-- tables and columns, so every statement here must be safe to re-run.
+
+CREATE TABLE IF NOT EXISTS messages (
+	id varchar NOT NULL,
+	channel_id varchar NOT NULL,
+	author_id varchar NOT NULL,
+	content varchar NOT NULL,
+	time_sent timestamptz NOT NULL,
+	edited_at timestamptz,
+	deleted_at timestamptz,
+	referenced_message_id varchar,
+	referenced_channel_id varchar,
+	reference_type varchar,
+	is_pinned boolean DEFAULT false,
+	CONSTRAINT messages_pk PRIMARY KEY (id)
+);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS edited_at timestamptz;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS referenced_message_id varchar;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS referenced_channel_id varchar;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS reference_type varchar;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS is_pinned boolean DEFAULT false;
+
+CREATE OR REPLACE VIEW reply_edges AS
+SELECT
+	replies.id AS message_id,
+	replies.channel_id,
+	replies.author_id,
+	replied_to.id AS replied_to_message_id,
+	replied_to.author_id AS replied_to_author_id,
+	replies.time_sent
+FROM
+	messages replies
+	JOIN messages replied_to ON replies.referenced_message_id = replied_to.id
+WHERE
+	replies.reference_type = 'reply';
+
+CREATE TABLE IF NOT EXISTS message_revisions (
+	message_id varchar NOT NULL,
+	content varchar NOT NULL,
+	edited_at timestamptz,
+	recorded_at timestamptz NOT NULL DEFAULT now(),
+);
+
+CREATE TABLE IF NOT EXISTS attachments (
+	id varchar NOT NULL,
+	message_id varchar NOT NULL,
+	filename varchar NOT NULL,
+	content_type varchar,
+	size bigint NOT NULL,
+	width integer,
+	height integer,
+	url varchar NOT NULL,
+	is_spoiler boolean NOT NULL DEFAULT false,
+	CONSTRAINT attachments_pk PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS reactions (
+	message_id varchar NOT NULL,
+	emoji_id varchar,
+	emoji_name varchar NOT NULL,
+	is_animated boolean NOT NULL DEFAULT false,
+	count integer NOT NULL,
+);
+
+CREATE TABLE IF NOT EXISTS message_mentions (
+	message_id varchar NOT NULL,
+	kind varchar NOT NULL,
+	target_id varchar,
+);
+
+CREATE TABLE IF NOT EXISTS import_checkpoints (
+	channel_id varchar NOT NULL,
+	direction varchar NOT NULL,
+	cursor varchar NOT NULL,
+	completed boolean NOT NULL DEFAULT false,
+	updated_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT import_checkpoints_pk PRIMARY KEY (channel_id, direction)
+);
+
+CREATE TABLE IF NOT EXISTS _user_cache (
+	id varchar NOT NULL,
+	username varchar NOT NULL,
+	display_name varchar NOT NULL,
+	is_bot boolean NOT NULL DEFAULT false,
+	cached_at timestamptz NOT NULL DEFAULT now(),
+);
+
+CREATE TABLE IF NOT EXISTS _invalid_user_cache (
+	id varchar NOT NULL,
+	cached_at timestamptz NOT NULL DEFAULT now(),
+);
@@ -0,0 +1,98 @@
+-- Users, channels and emoji were previously dropped and rebuilt on every open. They are replaced by history tables
+-- where each row is one version of an entity, valid from valid_from until valid_to, with views exposing the current
+-- version of each entity under the original table names.
+
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS channels;
+DROP TABLE IF EXISTS emoji;
+
+CREATE TABLE IF NOT EXISTS users_history (
+	id varchar NOT NULL,
+	username varchar NOT NULL,
+	display_name varchar NOT NULL,
+	is_bot boolean NOT NULL DEFAULT false,
+	in_guild boolean NOT NULL DEFAULT false,
+	joined_at timestamptz,
+	premium_since timestamptz,
+	timed_out_until timestamptz,
+	is_pending boolean,
+	avatar_url varchar,
+	valid_from timestamptz NOT NULL DEFAULT now(),
+	valid_to timestamptz,
+);
+
+CREATE TABLE IF NOT EXISTS channels_history (
+	id varchar NOT NULL,
+	name varchar NOT NULL,
+	parent_id varchar,
+	type varchar NOT NULL,
+	visibility varchar NOT NULL DEFAULT 'public',
+	topic varchar,
+	position integer NOT NULL DEFAULT 0,
+	is_nsfw boolean NOT NULL DEFAULT false,
+	rate_limit_per_user integer NOT NULL DEFAULT 0,
+	created_at timestamptz NOT NULL,
+	owner_id varchar,
+	is_archived boolean,
+	is_locked boolean,
+	message_count integer,
+	valid_from timestamptz NOT NULL DEFAULT now(),
+	valid_to timestamptz,
+);
+
+CREATE TABLE IF NOT EXISTS emoji_history (
+	id varchar NOT NULL,
+	name varchar NOT NULL,
+	is_animated boolean NOT NULL DEFAULT false,
+	valid_from timestamptz NOT NULL DEFAULT now(),
+	valid_to timestamptz,
+);
+
+CREATE OR REPLACE VIEW users AS
+SELECT
+	id,
+	username,
+	display_name,
+	is_bot,
+	in_guild,
+	joined_at,
+	premium_since,
+	timed_out_until,
+	is_pending,
+	avatar_url
+FROM
+	users_history
+WHERE
+	valid_to IS NULL;
+
+CREATE OR REPLACE VIEW channels AS
+SELECT
+	id,
+	name,
+	parent_id,
+	type,
+	visibility,
+	topic,
+	position,
+	is_nsfw,
+	rate_limit_per_user,
+	created_at,
+	owner_id,
+	is_archived,
+	is_locked,
+	message_count
+FROM
+	channels_history
+WHERE
+	valid_to IS NULL;
+
+CREATE OR REPLACE VIEW emoji AS
+SELECT
+	id,
+	name,
+	is_animated,
+	format('<{}:{}:{}>', CASE WHEN is_animated THEN 'a' ELSE '' END, name, id) AS usage_str
+FROM
+	emoji_history
+WHERE
+	valid_to IS NULL;
@@ -0,0 +1,14 @@
+CREATE SEQUENCE IF NOT EXISTS import_runs_id_seq;
+
+CREATE TABLE IF NOT EXISTS import_runs (
+	id integer NOT NULL DEFAULT nextval('import_runs_id_seq'),
+	started_at timestamptz NOT NULL,
+	finished_at timestamptz,
+	-- The config the import ran with, excluding the Discord token
+	config json NOT NULL,
+	-- Per-entity counts of inserted and updated rows, like {"messages": {"inserted": 10, "updated": 2}}
+	counts json,
+	errors json,
+	status varchar NOT NULL,
+	CONSTRAINT import_runs_pk PRIMARY KEY (id)
+);
@@ -0,0 +1,27 @@
+-- Whether the bot could read each channel when it was last imported, and why it was skipped if not.
+-- Both are NULL for channels whose access hasn't been checked, such as threads.
+ALTER TABLE channels_history ADD COLUMN IF NOT EXISTS accessible boolean;
+ALTER TABLE channels_history ADD COLUMN IF NOT EXISTS skip_reason varchar;
+
+CREATE OR REPLACE VIEW channels AS
+SELECT
+	id,
+	name,
+	parent_id,
+	type,
+	visibility,
+	topic,
+	position,
+	is_nsfw,
+	rate_limit_per_user,
+	created_at,
+	owner_id,
+	is_archived,
+	is_locked,
+	message_count,
+	accessible,
+	skip_reason
+FROM
+	channels_history
+WHERE
+	valid_to IS NULL;
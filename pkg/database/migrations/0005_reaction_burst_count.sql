@@ -0,0 +1,2 @@
+-- How many of a reaction's count are super reactions. Reactions stored before this column existed have a burst count of 0.
+ALTER TABLE reactions ADD COLUMN IF NOT EXISTS burst_count integer DEFAULT 0;
@@ -0,0 +1,44 @@
+-- The user caches had no key, so a user could be cached more than once. Both are rebuilt with a primary key on id,
+-- keeping only the most recent entry for each user.
+
+CREATE TABLE _user_cache_new (
+	id varchar NOT NULL,
+	username varchar NOT NULL,
+	display_name varchar NOT NULL,
+	is_bot boolean NOT NULL DEFAULT false,
+	cached_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT user_cache_pk PRIMARY KEY (id)
+);
+
+INSERT INTO _user_cache_new (id, username, display_name, is_bot, cached_at)
+SELECT
+	id,
+	username,
+	display_name,
+	is_bot,
+	cached_at
+FROM
+	_user_cache
+QUALIFY
+	row_number() OVER (PARTITION BY id ORDER BY cached_at DESC) = 1;
+
+DROP TABLE _user_cache;
+ALTER TABLE _user_cache_new RENAME TO _user_cache;
+
+CREATE TABLE _invalid_user_cache_new (
+	id varchar NOT NULL,
+	cached_at timestamptz NOT NULL DEFAULT now(),
+	CONSTRAINT invalid_user_cache_pk PRIMARY KEY (id)
+);
+
+INSERT INTO _invalid_user_cache_new (id, cached_at)
+SELECT
+	id,
+	max(cached_at)
+FROM
+	_invalid_user_cache
+GROUP BY
+	id;
+
+DROP TABLE _invalid_user_cache;
+ALTER TABLE _invalid_user_cache_new RENAME TO _invalid_user_cache;
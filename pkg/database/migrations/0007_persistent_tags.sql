@@ -0,0 +1,18 @@
+-- Forum and thread tags were previously dropped and rebuilt on every open, which lost the tags of any channel or thread
+-- not imported by a run, such as when channel filters are set or the run is cancelled. They are now kept between runs.
+
+CREATE TABLE IF NOT EXISTS forum_tags (
+	id varchar NOT NULL,
+	channel_id varchar NOT NULL,
+	name varchar NOT NULL,
+	is_moderated boolean NOT NULL DEFAULT false,
+	emoji_id varchar,
+	emoji_name varchar,
+	CONSTRAINT forum_tags_pk PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS thread_tags (
+	thread_id varchar NOT NULL,
+	tag_id varchar NOT NULL,
+	CONSTRAINT thread_tags_pk PRIMARY KEY (thread_id, tag_id)
+);
@@ -0,0 +1,20 @@
+-- Roles and member roles were previously dropped and rebuilt on every open, which left them empty if an import was
+-- stopped before reaching them. They are now kept between runs, with removed roles pruned as each run imports them.
+
+CREATE TABLE IF NOT EXISTS roles (
+	id varchar NOT NULL,
+	name varchar NOT NULL,
+	color integer NOT NULL,
+	position integer NOT NULL,
+	permissions bigint NOT NULL,
+	is_hoisted boolean NOT NULL DEFAULT false,
+	is_managed boolean NOT NULL DEFAULT false,
+	is_mentionable boolean NOT NULL DEFAULT false,
+	CONSTRAINT roles_pk PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS member_roles (
+	user_id varchar NOT NULL,
+	role_id varchar NOT NULL,
+	CONSTRAINT member_roles_pk PRIMARY KEY (user_id, role_id)
+);
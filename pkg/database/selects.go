@@ -2,11 +2,13 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 )
 
-func GetOldestMessageIdForChannel(db *sql.DB, channelId string) (string, error) {
+func GetOldestMessageIdForChannel(db Querier, channelId string) (string, error) {
 	var id string
 	err := db.QueryRow(
 		`SELECT
@@ -27,7 +29,7 @@ func GetOldestMessageIdForChannel(db *sql.DB, channelId string) (string, error)
 	return id, nil
 }
 
-func GetNewestMessageIdForChannel(db *sql.DB, channelId string) (string, error) {
+func GetNewestMessageIdForChannel(db Querier, channelId string) (string, error) {
 	var id string
 	err := db.QueryRow(
 		`SELECT
@@ -48,7 +50,80 @@ func GetNewestMessageIdForChannel(db *sql.DB, channelId string) (string, error)
 	return id, nil
 }
 
-func GetMissingAuthors(db *sql.DB) ([]string, error) {
+// GetMessageIdsForChannelSince returns the ids of all stored, non-deleted messages in a channel sent at or after the given time.
+func GetMessageIdsForChannelSince(db Querier, channelId string, since time.Time) ([]string, error) {
+	rows, err := db.Query(
+		`SELECT
+			id
+		FROM
+			main.messages
+		WHERE
+			channel_id = $1
+			AND time_sent >= $2
+			AND deleted_at IS NULL`,
+		channelId,
+		since,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+type StoredMessage struct {
+	Id       string
+	Content  string
+	EditedAt *time.Time
+}
+
+// GetStoredMessages returns the stored versions of the given messages, keyed by ID. Messages that haven't been stored
+// are left out.
+func GetStoredMessages(db Querier, messageIds []string) (map[string]*StoredMessage, error) {
+	stored := map[string]*StoredMessage{}
+	if len(messageIds) == 0 {
+		return stored, nil
+	}
+
+	rows, err := db.Query(
+		`SELECT
+			id,
+			content,
+			edited_at
+		FROM
+			main.messages
+		WHERE
+			id IN `+inPlaceholders(1, len(messageIds)),
+		anySlice(messageIds)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var message StoredMessage
+		err = rows.Scan(&message.Id, &message.Content, &message.EditedAt)
+		if err != nil {
+			return nil, err
+		}
+		stored[message.Id] = &message
+	}
+
+	return stored, rows.Err()
+}
+
+func GetMissingAuthors(db Querier) ([]string, error) {
 	rows, err := db.Query(
 		`SELECT
 			DISTINCT author_id
@@ -79,7 +154,7 @@ func GetMissingAuthors(db *sql.DB) ([]string, error) {
 	return authors, nil
 }
 
-func GetAllAuthors(db *sql.DB) ([]string, error) {
+func GetAllAuthors(db Querier) ([]string, error) {
 	rows, err := db.Query(`SELECT DISTINCT author_id FROM main.messages`)
 	if err != nil {
 		return nil, err
@@ -98,6 +173,147 @@ func GetAllAuthors(db *sql.DB) ([]string, error) {
 	return authors, nil
 }
 
+// selectIds runs a query returning a single column of IDs.
+func selectIds(db Querier, query string, args ...any) ([]string, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// GetCurrentMemberIds returns the IDs of all users currently recorded as members of the guild.
+func GetCurrentMemberIds(db Querier) ([]string, error) {
+	return selectIds(db, `SELECT id FROM main.users WHERE in_guild`)
+}
+
+// GetCurrentChannelIds returns the IDs of all current channels, excluding threads.
+func GetCurrentChannelIds(db Querier) ([]string, error) {
+	return selectIds(
+		db,
+		`SELECT
+			id
+		FROM
+			main.channels
+		WHERE
+			type NOT IN ('public_thread', 'private_thread', 'announcement_thread')`,
+	)
+}
+
+// GetCurrentEmojiIds returns the IDs of all current emoji.
+func GetCurrentEmojiIds(db Querier) ([]string, error) {
+	return selectIds(db, `SELECT id FROM main.emoji`)
+}
+
+type Checkpoint struct {
+	ChannelId string
+	Direction string
+	Cursor    string
+	Completed bool
+	UpdatedAt time.Time
+}
+
+func GetCheckpoint(db Querier, channelId string, direction string) (*Checkpoint, error) {
+	var checkpoint Checkpoint
+	err := db.QueryRow(
+		`SELECT
+			channel_id,
+			direction,
+			cursor,
+			completed,
+			updated_at
+		FROM
+			main.import_checkpoints
+		WHERE
+			channel_id = $1
+			AND direction = $2`,
+		channelId,
+		direction,
+	).Scan(&checkpoint.ChannelId, &checkpoint.Direction, &checkpoint.Cursor, &checkpoint.Completed, &checkpoint.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return &checkpoint, nil
+}
+
+type ImportRun struct {
+	Id         int64
+	StartedAt  time.Time
+	FinishedAt *time.Time
+	Status     string
+	Config     string
+	Counts     map[string]UpsertCounts
+	Errors     []string
+}
+
+// GetImportRuns returns the most recent import runs, newest first.
+func GetImportRuns(db Querier, limit int) ([]ImportRun, error) {
+	rows, err := db.Query(
+		`SELECT
+			id,
+			started_at,
+			finished_at,
+			status,
+			config::varchar,
+			counts::varchar,
+			errors::varchar
+		FROM
+			main.import_runs
+		ORDER BY
+			started_at DESC
+		LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []ImportRun
+	for rows.Next() {
+		var run ImportRun
+		var countsJson, errorsJson *string
+		err = rows.Scan(&run.Id, &run.StartedAt, &run.FinishedAt, &run.Status, &run.Config, &countsJson, &errorsJson)
+		if err != nil {
+			return nil, err
+		}
+
+		// Counts and errors are only recorded once a run finishes
+		if countsJson != nil {
+			err = json.Unmarshal([]byte(*countsJson), &run.Counts)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing counts for run %d: %w", run.Id, err)
+			}
+		}
+
+		if errorsJson != nil {
+			err = json.Unmarshal([]byte(*errorsJson), &run.Errors)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing errors for run %d: %w", run.Id, err)
+			}
+		}
+
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
 type CachedUser struct {
 	Id          string
 	Username    string
@@ -106,10 +322,8 @@ type CachedUser struct {
 	CachedAt    time.Time
 }
 
-func GetCachedUser(db *sql.DB, userId string) (*CachedUser, error) {
+func GetCachedUser(db Querier, userId string) (*CachedUser, error) {
 	var user CachedUser
-	// TODO: Limit & order is needed here due to having multiple cached entries for the same user.
-	// We should clean up old cache entries.
 	err := db.QueryRow(
 		`SELECT
 			id,
@@ -120,10 +334,7 @@ func GetCachedUser(db *sql.DB, userId string) (*CachedUser, error) {
 		FROM
 			main._user_cache
 		WHERE
-			id = $1
-		ORDER BY
-			cached_at DESC
-		LIMIT 1`,
+			id = $1`,
 		userId,
 	).Scan(&user.Id, &user.Username, &user.DisplayName, &user.IsBot, &user.CachedAt)
 	if err != nil {
@@ -146,10 +357,8 @@ type InvalidCachedUser struct {
 	CachedAt time.Time
 }
 
-func GetInvalidCachedUser(db *sql.DB, userId string) (bool, error) {
+func GetInvalidCachedUser(db Querier, userId string) (bool, error) {
 	var user InvalidCachedUser
-	// TODO: Limit & order is needed here due to having multiple cached entries for the same user.
-	// We should clean up old cache entries.
 	err := db.QueryRow(
 		`SELECT
 			id,
@@ -157,10 +366,7 @@ func GetInvalidCachedUser(db *sql.DB, userId string) (bool, error) {
 		FROM
 			main._invalid_user_cache
 		WHERE
-			id = $1
-		ORDER BY
-			cached_at DESC
-		LIMIT 1`,
+			id = $1`,
 		userId,
 	).Scan(&user.Id, &user.CachedAt)
 	if err != nil {
@@ -1,7 +1,13 @@
 package importer
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nint8835/discordgo"
@@ -10,45 +16,216 @@ import (
 	"github.com/nint8835/duckdbot/pkg/database"
 )
 
-func (i *Importer) importChannels() {
-	channels, err := i.Session.GuildChannels(i.Config.GuildId)
+func (i *Importer) importChannels(ctx context.Context) {
+	guildChannels, err := withRetry(ctx, i.Config, func() ([]*discordgo.Channel, error) {
+		return i.Session.GuildChannels(i.Config.GuildId, discordgo.WithContext(ctx))
+	})
 	if err != nil {
-		log.Error().Err(err).Msg("failed to get guild channels")
+		i.reportError(err, "failed to get guild channels")
 		return
 	}
 
+	// Otherwise a mistyped or thread ID would silently import nothing
+	for _, channelId := range unmatchedIncludedChannelIds(i.Config, guildChannels) {
+		i.reportError(
+			fmt.Errorf("channel %s is not a channel in the guild, threads must be imported through their parent channel", channelId),
+			"failed to apply channel filters",
+		)
+	}
+
+	// Filtered channels aren't stored at all, so excluded channels don't appear in the database
+	var channels []*discordgo.Channel
+	for _, channel := range guildChannels {
+		if !i.channelIncluded(channel) {
+			log.Debug().Msgf("Skipping filtered channel %s", channel.Name)
+			continue
+		}
+
+		channels = append(channels, channel)
+	}
+
+	counts, err := database.InsertChannels(i.Db, channels)
+	if err != nil {
+		i.reportError(err, "failed to insert channels")
+		return
+	}
+	i.run.addCounts("channels", counts)
+
+	// Deleted channels can only be detected from a complete channel list
+	if !hasChannelFilters(i.Config) {
+		seenChannelIds := map[string]bool{}
+		for _, channel := range channels {
+			seenChannelIds[channel.ID] = true
+		}
+
+		deletedCount, err := i.closeMissing(seenChannelIds, database.GetCurrentChannelIds, database.MarkChannelDeleted)
+		if err != nil {
+			i.reportError(err, "failed to mark deleted channels")
+		} else {
+			log.Info().Msgf("Marked %d channels as deleted", deletedCount)
+		}
+	}
+
+	// If access can't be checked, every channel is attempted and any the bot can't read will fail individually
+	skipReasons := map[string]string{}
+	i.botPermissions, err = i.botChannelPermissions(ctx, channels)
+	if err != nil {
+		i.reportError(err, "failed to check channel access")
+	} else {
+		for _, channel := range channels {
+			reason := channelSkipReason(i.botPermissions[channel.ID])
+			if reason != "" {
+				skipReasons[channel.ID] = reason
+			}
+		}
+
+		err = database.InTransaction(i.Db, func(tx *sql.Tx) error {
+			for _, channel := range channels {
+				err := database.UpdateChannelAccess(tx, channel.ID, skipReasons[channel.ID])
+				if err != nil {
+					return fmt.Errorf("error updating access for channel %s: %w", channel.ID, err)
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			i.reportError(err, "failed to record channel access")
+		}
+	}
+
+	var accessibleChannels []*discordgo.Channel
 	for _, channel := range channels {
-		i.importChannel(channel)
+		if reason, skipped := skipReasons[channel.ID]; skipped {
+			log.Warn().Msgf("Skipping channel %s: %s", channel.Name, reason)
+			i.run.addSkippedChannel(SkippedChannel{Id: channel.ID, Name: channel.Name, Reason: reason})
+			continue
+		}
+
+		accessibleChannels = append(accessibleChannels, channel)
+	}
+
+	i.startWriter()
+	defer i.stopWriter()
+
+	channelQueue := make(chan *discordgo.Channel)
+
+	var completedCount atomic.Int64
+
+	var wg sync.WaitGroup
+	for range max(i.Config.ImportConcurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for channel := range channelQueue {
+				i.importChannel(ctx, channel)
+
+				if ctx.Err() == nil {
+					completedCount.Add(1)
+				}
+			}
+		}()
+	}
+
+queueChannels:
+	for _, channel := range accessibleChannels {
+		select {
+		case channelQueue <- channel:
+		case <-ctx.Done():
+			break queueChannels
+		}
 	}
+	close(channelQueue)
+
+	wg.Wait()
+
+	log.Info().Msgf("Imported %d of %d channels", completedCount.Load(), len(accessibleChannels))
 }
 
-func (i *Importer) importChannel(channel *discordgo.Channel) {
+func (i *Importer) importChannel(ctx context.Context, channel *discordgo.Channel) {
 	log.Info().Msgf("Importing channel %s", channel.Name)
 
-	err := database.InsertChannel(i.Db, channel)
-	if err != nil {
-		log.Error().Err(err).Msg("failed to insert channel")
-		return
+	// Forum and media channels have no messages of their own, all of their content lives in threads
+	if channel.Type != discordgo.ChannelTypeGuildForum && channel.Type != discordgo.ChannelTypeGuildMedia {
+		err := i.importChannelMessages(ctx, channel)
+		if ctx.Err() != nil {
+			log.Debug().Msgf("Import of channel %s cancelled", channel.Name)
+			return
+		}
+		if err != nil {
+			i.reportError(err, fmt.Sprintf("failed to import channel %s (%s)", channel.Name, channel.ID))
+			return
+		}
+	}
+
+	switch channel.Type {
+	case discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildNews, discordgo.ChannelTypeGuildForum, discordgo.ChannelTypeGuildMedia:
+		i.importThreads(ctx, channel)
 	}
+}
+
+type threadFetcher func(ctx context.Context, channelId string, session *discordgo.Session, prevThreads []*discordgo.Channel) (*discordgo.ThreadsList, error)
 
-	err = i.importChannelMessages(channel)
+func publicArchivedThreadFetcher(ctx context.Context, channelId string, session *discordgo.Session, prevThreads []*discordgo.Channel) (*discordgo.ThreadsList, error) {
+	var before *time.Time
+
+	if len(prevThreads) > 0 {
+		before = &prevThreads[len(prevThreads)-1].ThreadMetadata.ArchiveTimestamp
+	}
+
+	return session.ThreadsArchived(channelId, before, 100, discordgo.WithContext(ctx))
+}
+
+func privateArchivedThreadFetcher(ctx context.Context, channelId string, session *discordgo.Session, prevThreads []*discordgo.Channel) (*discordgo.ThreadsList, error) {
+	var before *time.Time
+
+	if len(prevThreads) > 0 {
+		before = &prevThreads[len(prevThreads)-1].ThreadMetadata.ArchiveTimestamp
+	}
+
+	return session.ThreadsPrivateArchived(channelId, before, 100, discordgo.WithContext(ctx))
+}
+
+// joinedPrivateArchivedThreadFetcher requests the endpoint directly, as it paginates by thread ID rather than
+// archive timestamp, which discordgo's ThreadsPrivateJoinedArchived doesn't support.
+func joinedPrivateArchivedThreadFetcher(ctx context.Context, channelId string, session *discordgo.Session, prevThreads []*discordgo.Channel) (*discordgo.ThreadsList, error) {
+	endpoint := discordgo.EndpointChannelJoinedPrivateArchivedThreads(channelId)
+
+	query := url.Values{}
+	query.Set("limit", "100")
+
+	if len(prevThreads) > 0 {
+		query.Set("before", prevThreads[len(prevThreads)-1].ID)
+	}
+
+	body, err := session.RequestWithBucketID("GET", endpoint+"?"+query.Encode(), nil, endpoint, discordgo.WithContext(ctx))
 	if err != nil {
-		log.Error().Err(err).Msg("failed to import channel")
-		return
+		return nil, err
 	}
 
-	if channel.Type == discordgo.ChannelTypeGuildText {
-		i.importThreads(channel)
+	var threads *discordgo.ThreadsList
+	err = discordgo.Unmarshal(body, &threads)
+	if err != nil {
+		return nil, err
 	}
+
+	return threads, nil
 }
 
-func (i *Importer) paginateArchivedThreads(channelId string, callback func(*discordgo.Channel)) error {
-	var lastThreadTime *time.Time
+func (i *Importer) paginateArchivedThreads(ctx context.Context, channelId string, fetcher threadFetcher, callback func(*discordgo.Channel)) error {
+	var prevThreads []*discordgo.Channel
 
 	hasMoreThreads := true
 
 	for hasMoreThreads {
-		threads, err := i.Session.ThreadsArchived(channelId, lastThreadTime, 100)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		threads, err := withRetry(ctx, i.Config, func() (*discordgo.ThreadsList, error) {
+			return fetcher(ctx, channelId, i.Session, prevThreads)
+		})
 		if err != nil {
 			return fmt.Errorf("error getting archived threads: %w", err)
 		}
@@ -60,50 +237,116 @@ func (i *Importer) paginateArchivedThreads(channelId string, callback func(*disc
 		hasMoreThreads = threads.HasMore
 
 		if len(threads.Threads) != 0 {
-			lastThreadTime = &threads.Threads[len(threads.Threads)-1].ThreadMetadata.ArchiveTimestamp
+			prevThreads = threads.Threads
 		}
 	}
 
 	return nil
 }
 
-func (i *Importer) importThreads(channel *discordgo.Channel) {
+func (i *Importer) importThreads(ctx context.Context, channel *discordgo.Channel) {
 	log.Info().Msgf("Importing threads for channel %s", channel.Name)
-	channelThreads, err := i.Session.ThreadsArchived(channel.ID, nil, 0)
-	if err != nil {
-		log.Error().Err(err).Msg("failed to get threads")
-		return
+
+	// A thread can be returned by more than one endpoint, such as private threads the bot has joined
+	importedThreads := map[string]bool{}
+	importThreadOnce := func(thread *discordgo.Channel) {
+		if importedThreads[thread.ID] || ctx.Err() != nil {
+			return
+		}
+		importedThreads[thread.ID] = true
+
+		if thread.Type == discordgo.ChannelTypeGuildPrivateThread && !i.Config.ImportPrivateThreads {
+			return
+		}
+
+		if !i.threadIncluded(thread) {
+			log.Debug().Msgf("Skipping filtered thread %s", thread.Name)
+			return
+		}
+
+		i.importThread(ctx, thread)
 	}
 
-	err = i.paginateArchivedThreads(channel.ID, i.importThread)
+	err := i.paginateArchivedThreads(ctx, channel.ID, publicArchivedThreadFetcher, importThreadOnce)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to import archived threads")
+		i.reportError(err, fmt.Sprintf("failed to import archived threads for channel %s (%s)", channel.Name, channel.ID))
 		return
 	}
 
-	channelThreads, err = i.Session.ThreadsActive(channel.ID)
+	// Only text channels can contain private threads
+	if i.Config.ImportPrivateThreads && channel.Type == discordgo.ChannelTypeGuildText {
+		i.importPrivateArchivedThreads(ctx, channel, importThreadOnce)
+
+		err = i.paginateArchivedThreads(ctx, channel.ID, joinedPrivateArchivedThreadFetcher, importThreadOnce)
+		if err != nil {
+			i.reportError(err, fmt.Sprintf("failed to import joined private archived threads for channel %s (%s)", channel.Name, channel.ID))
+		}
+	}
+
+	channelThreads, err := withRetry(ctx, i.Config, func() (*discordgo.ThreadsList, error) {
+		return i.Session.ThreadsActive(channel.ID, discordgo.WithContext(ctx))
+	})
 	if err != nil {
-		log.Error().Err(err).Msg("failed to get threads")
+		i.reportError(err, fmt.Sprintf("failed to get threads for channel %s (%s)", channel.Name, channel.ID))
 		return
 	}
 
 	for _, thread := range channelThreads.Threads {
-		i.importThread(thread)
+		importThreadOnce(thread)
 	}
 }
 
-func (i *Importer) importThread(thread *discordgo.Channel) {
+// importPrivateArchivedThreads imports every private archived thread in a channel, which requires MANAGE_THREADS.
+// Without it, only the private threads the bot has joined can be listed, so the channel's other private threads are skipped.
+func (i *Importer) importPrivateArchivedThreads(ctx context.Context, channel *discordgo.Channel, callback func(*discordgo.Channel)) {
+	permissions, checked := i.botPermissions[channel.ID]
+	if checked && permissions&discordgo.PermissionManageThreads == 0 {
+		log.Debug().Msgf("Skipping private archived threads for channel %s: missing permission MANAGE_THREADS", channel.Name)
+		return
+	}
+
+	err := i.paginateArchivedThreads(ctx, channel.ID, privateArchivedThreadFetcher, callback)
+	// The computed permissions can be stale or unavailable, so Discord rejecting the request is treated the same way
+	if restErrorStatus(err) == http.StatusForbidden {
+		log.Warn().Msgf("Skipping private archived threads for channel %s: missing access", channel.Name)
+		return
+	}
+	if err != nil {
+		i.reportError(err, fmt.Sprintf("failed to import private archived threads for channel %s (%s)", channel.Name, channel.ID))
+	}
+}
+
+func (i *Importer) importThread(ctx context.Context, thread *discordgo.Channel) {
 	log.Info().Msgf("Importing thread %s", thread.Name)
 
-	err := database.InsertThread(i.Db, thread)
+	err := i.withDb(func(db *sql.DB) error {
+		return database.InTransaction(db, func(tx *sql.Tx) error {
+			result, err := database.InsertThread(tx, thread)
+			if err != nil {
+				return err
+			}
+			i.run.addResult("threads", result)
+
+			err = database.ReplaceThreadTags(tx, thread)
+			if err != nil {
+				return fmt.Errorf("error inserting thread tags: %w", err)
+			}
+
+			return nil
+		})
+	})
 	if err != nil {
-		log.Error().Err(err).Msg("failed to insert thread")
+		i.reportError(err, fmt.Sprintf("failed to insert thread %s (%s)", thread.Name, thread.ID))
 		return
 	}
 
-	err = i.importChannelMessages(thread)
+	err = i.importChannelMessages(ctx, thread)
+	if ctx.Err() != nil {
+		log.Debug().Msgf("Import of thread %s cancelled", thread.Name)
+		return
+	}
 	if err != nil {
-		log.Error().Err(err).Msg("failed to import thread")
+		i.reportError(err, fmt.Sprintf("failed to import thread %s (%s)", thread.Name, thread.ID))
 		return
 	}
 }
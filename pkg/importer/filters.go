@@ -0,0 +1,90 @@
+package importer
+
+import (
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/nint8835/discordgo"
+
+	"github.com/nint8835/duckdbot/pkg/config"
+)
+
+// validateChannelFilters checks that every channel name pattern in the config is a valid glob.
+func validateChannelFilters(cfg *config.Config) error {
+	for _, pattern := range slices.Concat(cfg.IncludeChannelNames, cfg.ExcludeChannelNames) {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return fmt.Errorf("invalid channel name pattern %s: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// hasChannelFilters reports whether any channel filters are configured, in which case not every channel is imported.
+func hasChannelFilters(cfg *config.Config) bool {
+	return len(cfg.IncludeChannelIds) > 0 ||
+		len(cfg.IncludeCategoryIds) > 0 ||
+		len(cfg.IncludeChannelNames) > 0 ||
+		len(cfg.ExcludeChannelIds) > 0 ||
+		len(cfg.ExcludeCategoryIds) > 0 ||
+		len(cfg.ExcludeChannelNames) > 0
+}
+
+// unmatchedIncludedChannelIds returns the included channel IDs that aren't any of the given guild channels. These are
+// usually typos or thread IDs, as threads can only be imported through their parent channel.
+func unmatchedIncludedChannelIds(cfg *config.Config, guildChannels []*discordgo.Channel) []string {
+	var unmatched []string
+	for _, channelId := range cfg.IncludeChannelIds {
+		found := slices.ContainsFunc(guildChannels, func(channel *discordgo.Channel) bool {
+			return channel.ID == channelId
+		})
+		if !found {
+			unmatched = append(unmatched, channelId)
+		}
+	}
+
+	return unmatched
+}
+
+// matchesChannel reports whether a channel has one of the given IDs, is in one of the given categories, or has a name
+// matching one of the given patterns.
+func matchesChannel(channel *discordgo.Channel, ids []string, categoryIds []string, namePatterns []string) bool {
+	if slices.Contains(ids, channel.ID) {
+		return true
+	}
+
+	if channel.ParentID != "" && slices.Contains(categoryIds, channel.ParentID) {
+		return true
+	}
+
+	for _, pattern := range namePatterns {
+		// Patterns are validated before the import starts
+		if matched, _ := path.Match(pattern, channel.Name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// channelIncluded reports whether a channel should be imported. If any include filters are set, only channels matching
+// them are imported, and channels matching an exclude filter are never imported.
+func (i *Importer) channelIncluded(channel *discordgo.Channel) bool {
+	if matchesChannel(channel, i.Config.ExcludeChannelIds, i.Config.ExcludeCategoryIds, i.Config.ExcludeChannelNames) {
+		return false
+	}
+
+	if len(i.Config.IncludeChannelIds) == 0 && len(i.Config.IncludeCategoryIds) == 0 && len(i.Config.IncludeChannelNames) == 0 {
+		return true
+	}
+
+	return matchesChannel(channel, i.Config.IncludeChannelIds, i.Config.IncludeCategoryIds, i.Config.IncludeChannelNames)
+}
+
+// threadIncluded reports whether a thread should be imported. Threads are imported along with their parent channel,
+// so only the exclude filters for channel IDs and names apply to them.
+func (i *Importer) threadIncluded(thread *discordgo.Channel) bool {
+	return !matchesChannel(thread, i.Config.ExcludeChannelIds, nil, i.Config.ExcludeChannelNames)
+}
@@ -0,0 +1,132 @@
+package importer
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/nint8835/discordgo"
+
+	"github.com/nint8835/duckdbot/pkg/config"
+)
+
+func TestChannelIncluded(t *testing.T) {
+	general := &discordgo.Channel{ID: "10", Name: "general", ParentID: "1"}
+	archive := &discordgo.Channel{ID: "11", Name: "archive-2023", ParentID: "1"}
+	offtopic := &discordgo.Channel{ID: "12", Name: "off-topic", ParentID: "2"}
+	uncategorised := &discordgo.Channel{ID: "13", Name: "rules"}
+
+	tests := []struct {
+		name   string
+		config config.Config
+		want   map[*discordgo.Channel]bool
+	}{
+		{
+			name:   "no filters",
+			config: config.Config{},
+			want:   map[*discordgo.Channel]bool{general: true, archive: true, offtopic: true, uncategorised: true},
+		},
+		{
+			name:   "include by ID",
+			config: config.Config{IncludeChannelIds: []string{"10"}},
+			want:   map[*discordgo.Channel]bool{general: true, archive: false, offtopic: false, uncategorised: false},
+		},
+		{
+			name:   "include by category",
+			config: config.Config{IncludeCategoryIds: []string{"1"}},
+			want:   map[*discordgo.Channel]bool{general: true, archive: true, offtopic: false, uncategorised: false},
+		},
+		{
+			name:   "include by name",
+			config: config.Config{IncludeChannelNames: []string{"off-*"}},
+			want:   map[*discordgo.Channel]bool{general: false, archive: false, offtopic: true, uncategorised: false},
+		},
+		{
+			name:   "exclude only",
+			config: config.Config{ExcludeChannelNames: []string{"archive-*"}},
+			want:   map[*discordgo.Channel]bool{general: true, archive: false, offtopic: true, uncategorised: true},
+		},
+		{
+			name: "exclude by name beats include by category",
+			config: config.Config{
+				IncludeCategoryIds:  []string{"1"},
+				ExcludeChannelNames: []string{"archive-*"},
+			},
+			want: map[*discordgo.Channel]bool{general: true, archive: false, offtopic: false, uncategorised: false},
+		},
+		{
+			name: "exclude by category beats include by ID",
+			config: config.Config{
+				IncludeChannelIds:  []string{"10", "12"},
+				ExcludeCategoryIds: []string{"1"},
+			},
+			want: map[*discordgo.Channel]bool{general: false, archive: false, offtopic: true, uncategorised: false},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			importer := &Importer{Config: &test.config}
+
+			for channel, want := range test.want {
+				got := importer.channelIncluded(channel)
+				if got != want {
+					t.Errorf("channelIncluded(%s) = %t, want %t", channel.Name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestThreadIncluded(t *testing.T) {
+	cfg := &config.Config{
+		IncludeChannelIds:   []string{"10"},
+		ExcludeChannelIds:   []string{"20"},
+		ExcludeCategoryIds:  []string{"10"},
+		ExcludeChannelNames: []string{"secret-*"},
+	}
+	importer := &Importer{Config: cfg}
+
+	tests := []struct {
+		thread *discordgo.Channel
+		want   bool
+	}{
+		// Category filters don't apply to threads, even though a thread's parent is stored in the same field
+		{&discordgo.Channel{ID: "21", Name: "question", ParentID: "10"}, true},
+		{&discordgo.Channel{ID: "20", Name: "question", ParentID: "10"}, false},
+		{&discordgo.Channel{ID: "22", Name: "secret-plans", ParentID: "10"}, false},
+	}
+
+	for _, test := range tests {
+		got := importer.threadIncluded(test.thread)
+		if got != test.want {
+			t.Errorf("threadIncluded(%s) = %t, want %t", test.thread.ID, got, test.want)
+		}
+	}
+}
+
+func TestUnmatchedIncludedChannelIds(t *testing.T) {
+	guildChannels := []*discordgo.Channel{{ID: "10"}, {ID: "11"}}
+
+	cfg := &config.Config{IncludeChannelIds: []string{"10", "20", "11", "21"}}
+	got := unmatchedIncludedChannelIds(cfg, guildChannels)
+	if !slices.Equal(got, []string{"20", "21"}) {
+		t.Errorf("unmatchedIncludedChannelIds() = %v, want [20 21]", got)
+	}
+
+	got = unmatchedIncludedChannelIds(&config.Config{}, guildChannels)
+	if len(got) != 0 {
+		t.Errorf("unmatchedIncludedChannelIds() = %v with no included IDs, want none", got)
+	}
+}
+
+func TestValidateChannelFilters(t *testing.T) {
+	err := validateChannelFilters(&config.Config{IncludeChannelNames: []string{"general-*"}})
+	if err != nil {
+		t.Errorf("validateChannelFilters() returned error for valid pattern: %s", err)
+	}
+
+	err = validateChannelFilters(&config.Config{ExcludeChannelNames: []string{"[general"}})
+	if err == nil {
+		t.Error("validateChannelFilters() returned no error for invalid pattern")
+	}
+}
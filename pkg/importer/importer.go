@@ -1,7 +1,10 @@
 package importer
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 
 	"github.com/nint8835/discordgo"
 	"github.com/rs/zerolog/log"
@@ -14,35 +17,157 @@ type Importer struct {
 	Db      *sql.DB
 	Session *discordgo.Session
 	Config  *config.Config
+
+	dbJobs     chan dbJob
+	writerDone chan struct{}
+
+	// botPermissions holds the bot's permissions in each imported channel, or is nil if they couldn't be checked
+	botPermissions map[string]int64
+
+	run *importRun
 }
 
-func (i *Importer) ImportAll() error {
+// ImportAll imports the configured guild, recording the run in the import_runs table and returning a summary of it.
+// Errors are collected according to the configured error policy and returned joined together once the import stops.
+// If ctx is cancelled, the import stops after any in-progress database writes have finished and the context's error
+// is returned.
+func (i *Importer) ImportAll(ctx context.Context) (*RunSummary, error) {
 	log.Info().Msg("Importing guild")
 
-	i.importChannels()
+	switch i.Config.ErrorPolicy {
+	case ErrorPolicyContinue, ErrorPolicyFailFast:
+	default:
+		return nil, fmt.Errorf("unknown error policy %s", i.Config.ErrorPolicy)
+	}
+
+	err := validateChannelFilters(i.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	importCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	err = i.startRun(cancel)
+	if err != nil {
+		return nil, fmt.Errorf("error starting import run: %w", err)
+	}
+
+	steps := []struct {
+		name string
+		run  func(context.Context)
+	}{
+		{"channels", i.importChannels},
+		{"roles", i.importRoles},
+		{"members", i.importMembers},
+		{"missing users", i.importMissingUsers},
+		{"emojis", i.importEmojis},
+	}
+
+	var completedSteps []string
+
+	for _, step := range steps {
+		step.run(importCtx)
+
+		if ctx.Err() != nil {
+			log.Warn().Strs("completed_steps", completedSteps).Msgf("Import cancelled while importing %s", step.name)
+			return i.finishRun(database.RunStatusCancelled), ctx.Err()
+		}
 
-	i.importMembers()
-	i.importMissingUsers()
+		if importCtx.Err() != nil {
+			log.Warn().Strs("completed_steps", completedSteps).Msgf("Import stopped after an error while importing %s", step.name)
+			break
+		}
+
+		completedSteps = append(completedSteps, step.name)
+	}
 
-	i.importEmojis()
+	summary := i.finishRun("")
 
-	return nil
+	return summary, errors.Join(summary.Errors...)
 }
 
-func (i *Importer) importEmojis() {
-	emojis, err := i.Session.GuildEmojis(i.Config.GuildId)
+// closeMissing marks every stored entity which was not seen during this import as no longer present in the guild,
+// returning how many were marked.
+func (i *Importer) closeMissing(
+	seenIds map[string]bool,
+	getStoredIds func(database.Querier) ([]string, error),
+	markMissing func(database.Querier, string) error,
+) (int, error) {
+	storedIds, err := getStoredIds(i.Db)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to get guild emojis")
+		return 0, fmt.Errorf("error getting stored ids: %w", err)
+	}
+
+	missingCount := 0
+
+	err = database.InTransaction(i.Db, func(tx *sql.Tx) error {
+		for _, id := range storedIds {
+			if seenIds[id] {
+				continue
+			}
+
+			err := markMissing(tx, id)
+			if err != nil {
+				return fmt.Errorf("error marking %s as missing: %w", id, err)
+			}
+
+			missingCount++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return missingCount, nil
+}
+
+func (i *Importer) importEmojis(ctx context.Context) {
+	emojis, err := withRetry(ctx, i.Config, func() ([]*discordgo.Emoji, error) {
+		return i.Session.GuildEmojis(i.Config.GuildId, discordgo.WithContext(ctx))
+	})
+	if err != nil {
+		i.reportError(err, "failed to get guild emojis")
 		return
 	}
 
+	seenEmojiIds := map[string]bool{}
 	for _, emoji := range emojis {
 		log.Info().Msgf("Importing emoji %s", emoji.Name)
+		seenEmojiIds[emoji.ID] = true
+	}
 
-		err = database.InsertEmoji(i.Db, emoji)
-		if err != nil {
-			log.Error().Err(err).Msg("failed to insert emoji")
-			continue
-		}
+	counts, err := database.InsertEmojis(i.Db, emojis)
+	if err != nil {
+		i.reportError(err, "failed to insert emojis")
+		return
+	}
+	i.run.addCounts("emoji", counts)
+
+	deletedCount, err := i.closeMissing(seenEmojiIds, database.GetCurrentEmojiIds, database.MarkEmojiDeleted)
+	if err != nil {
+		i.reportError(err, "failed to mark deleted emojis")
+		return
+	}
+
+	log.Info().Msgf("Marked %d emojis as deleted", deletedCount)
+}
+
+func (i *Importer) importRoles(ctx context.Context) {
+	roles, err := withRetry(ctx, i.Config, func() ([]*discordgo.Role, error) {
+		return i.Session.GuildRoles(i.Config.GuildId, discordgo.WithContext(ctx))
+	})
+	if err != nil {
+		i.reportError(err, "failed to get guild roles")
+		return
+	}
+
+	log.Info().Msgf("Importing %d roles", len(roles))
+
+	err = database.ReplaceRoles(i.Db, roles)
+	if err != nil {
+		i.reportError(err, "failed to insert roles")
 	}
 }
@@ -1,7 +1,15 @@
 package importer
 
 import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/nint8835/discordgo"
 	"github.com/rs/zerolog/log"
@@ -9,58 +17,235 @@ import (
 	"github.com/nint8835/duckdbot/pkg/database"
 )
 
-type messageFetcher func(channelId string, initialMessageId string, session *discordgo.Session, prevMessages []*discordgo.Message) ([]*discordgo.Message, error)
+// discordEpoch is the Unix time, in milliseconds, that Discord snowflakes are relative to.
+const discordEpoch = 1420070400000
 
-func olderMessageFetcher(channelId string, initialMessageId string, session *discordgo.Session, prevMessages []*discordgo.Message) ([]*discordgo.Message, error) {
+// snowflakeFromTime returns the smallest snowflake that could have been created at the given time.
+// Times before the Discord epoch return 0, as no snowflake can predate it.
+func snowflakeFromTime(t time.Time) string {
+	return strconv.FormatInt(max(t.UnixMilli()-discordEpoch, 0)<<22, 10)
+}
+
+// snowflakeBeforeTime returns the largest snowflake that could have been created before the given time, so it can be
+// passed to Discord as an exclusive after bound that still includes messages created at that time.
+// Times at or before the Discord epoch return 0.
+func snowflakeBeforeTime(t time.Time) string {
+	millis := t.UnixMilli() - discordEpoch
+	if millis <= 0 {
+		return "0"
+	}
+
+	return strconv.FormatInt(millis<<22-1, 10)
+}
+
+// compareSnowflakes compares two snowflakes numerically.
+func compareSnowflakes(a string, b string) int {
+	return cmp.Or(cmp.Compare(len(a), len(b)), strings.Compare(a, b))
+}
+
+// messageWindow limits fetched messages to those with IDs after afterId and before beforeId, both exclusive.
+// Either may be empty to leave that side of the window open.
+type messageWindow struct {
+	afterId  string
+	beforeId string
+}
+
+func (i *Importer) messageWindow() messageWindow {
+	var window messageWindow
+
+	if i.Config.ImportSince != nil {
+		// --since is inclusive, so messages created at exactly that time must be after the bound
+		window.afterId = snowflakeBeforeTime(*i.Config.ImportSince)
+	}
+
+	if i.Config.ImportUntil != nil {
+		window.beforeId = snowflakeFromTime(*i.Config.ImportUntil)
+	}
+
+	return window
+}
+
+// fetchChannelMessages requests a page of messages directly rather than through discordgo's ChannelMessages,
+// so reaction burst counts, which discordgo doesn't decode, can be read from the same response.
+func fetchChannelMessages(ctx context.Context, session *discordgo.Session, channelId string, beforeId string, afterId string) (database.MessagePage, error) {
+	endpoint := discordgo.EndpointChannelMessages(channelId)
+
+	query := url.Values{}
+	query.Set("limit", "100")
+	if beforeId != "" {
+		query.Set("before", beforeId)
+	}
+	if afterId != "" {
+		query.Set("after", afterId)
+	}
+
+	body, err := session.RequestWithBucketID("GET", endpoint+"?"+query.Encode(), nil, endpoint, discordgo.WithContext(ctx))
+	if err != nil {
+		return database.MessagePage{}, err
+	}
+
+	var messages []*discordgo.Message
+	err = discordgo.Unmarshal(body, &messages)
+	if err != nil {
+		return database.MessagePage{}, err
+	}
+
+	var reactionDetails []struct {
+		ID        string `json:"id"`
+		Reactions []struct {
+			CountDetails struct {
+				Burst int `json:"burst"`
+			} `json:"count_details"`
+		} `json:"reactions"`
+	}
+	err = discordgo.Unmarshal(body, &reactionDetails)
+	if err != nil {
+		return database.MessagePage{}, err
+	}
+
+	burstCounts := map[string][]int{}
+	for _, message := range reactionDetails {
+		for _, reaction := range message.Reactions {
+			burstCounts[message.ID] = append(burstCounts[message.ID], reaction.CountDetails.Burst)
+		}
+	}
+
+	return database.MessagePage{Messages: messages, ReactionBurstCounts: burstCounts}, nil
+}
+
+type messageFetcher func(ctx context.Context, channelId string, initialMessageId string, window messageWindow, session *discordgo.Session, prevMessages []*discordgo.Message) (database.MessagePage, error)
+
+func olderMessageFetcher(ctx context.Context, channelId string, initialMessageId string, window messageWindow, session *discordgo.Session, prevMessages []*discordgo.Message) (database.MessagePage, error) {
 	beforeId := initialMessageId
 
 	if prevMessages != nil && len(prevMessages) > 0 {
 		beforeId = prevMessages[len(prevMessages)-1].ID
 	}
 
-	return session.ChannelMessages(channelId, 100, beforeId, "", "")
+	if window.beforeId != "" && (beforeId == "" || compareSnowflakes(window.beforeId, beforeId) < 0) {
+		beforeId = window.beforeId
+	}
+
+	page, err := fetchChannelMessages(ctx, session, channelId, beforeId, "")
+	if err != nil {
+		return database.MessagePage{}, err
+	}
+
+	// Messages are returned newest first, so once one is outside the window, so are all that follow it
+	if window.afterId != "" {
+		for index, message := range page.Messages {
+			if compareSnowflakes(message.ID, window.afterId) <= 0 {
+				page.Messages = page.Messages[:index]
+				break
+			}
+		}
+	}
+
+	return page, nil
 }
 
-func newerMessageFetcher(channelId string, initialMessageId string, session *discordgo.Session, prevMessages []*discordgo.Message) ([]*discordgo.Message, error) {
+func newerMessageFetcher(ctx context.Context, channelId string, initialMessageId string, window messageWindow, session *discordgo.Session, prevMessages []*discordgo.Message) (database.MessagePage, error) {
 	afterId := initialMessageId
 
 	if prevMessages != nil && len(prevMessages) > 0 {
 		afterId = prevMessages[0].ID
 	}
 
-	return session.ChannelMessages(channelId, 100, "", afterId, "")
+	if window.afterId != "" && (afterId == "" || compareSnowflakes(window.afterId, afterId) > 0) {
+		afterId = window.afterId
+	}
+
+	page, err := fetchChannelMessages(ctx, session, channelId, "", afterId)
+	if err != nil {
+		return database.MessagePage{}, err
+	}
+
+	// Messages are returned newest first, so the ones beyond the end of the window are at the start of the page
+	if window.beforeId != "" {
+		inWindow := len(page.Messages)
+		for index, message := range page.Messages {
+			if compareSnowflakes(message.ID, window.beforeId) < 0 {
+				inWindow = index
+				break
+			}
+		}
+		page.Messages = page.Messages[inWindow:]
+	}
+
+	return page, nil
 }
 
-func (i *Importer) importMessages(messages []*discordgo.Message) error {
-	for _, message := range messages {
-		err := database.InsertMessage(i.Db, message)
+func (i *Importer) importMessages(page database.MessagePage) error {
+	return i.withDb(func(db *sql.DB) error {
+		counts, err := database.InsertMessages(db, page)
 		if err != nil {
-			return fmt.Errorf("error inserting message: %w", err)
+			return err
+		}
+		i.run.addCounts("messages", counts)
+
+		return nil
+	})
+}
+
+// importMessagesWithCheckpoint returns a page callback which commits each page of messages along with the channel's checkpoint
+// for the given direction.
+func (i *Importer) importMessagesWithCheckpoint(channelId string, direction string) func(database.MessagePage) error {
+	return func(page database.MessagePage) error {
+		// Messages are returned newest first, so the cursor is whichever end of the page the import is moving towards
+		cursor := page.Messages[0].ID
+		if direction == database.CheckpointDirectionOlder {
+			cursor = page.Messages[len(page.Messages)-1].ID
 		}
+
+		return i.withDb(func(db *sql.DB) error {
+			counts, err := database.InsertMessagesWithCheckpoint(db, page, channelId, direction, cursor)
+			if err != nil {
+				return err
+			}
+			i.run.addCounts("messages", counts)
+
+			return nil
+		})
 	}
+}
 
-	return nil
+func (i *Importer) completeCheckpoint(channelId string, direction string, cursor string) error {
+	return i.withDb(func(db *sql.DB) error {
+		return database.CompleteCheckpoint(db, channelId, direction, cursor)
+	})
 }
 
-func (i *Importer) paginateMessages(channelId string, initialMessageId string, fetcher messageFetcher, callback func([]*discordgo.Message) error) error {
-	messages, err := fetcher(channelId, initialMessageId, i.Session, nil)
+// paginateMessages fetches and processes pages of messages until none remain or ctx is cancelled.
+// A page that has already been fetched is always processed before cancellation is checked, so no fetched page is lost.
+func (i *Importer) paginateMessages(ctx context.Context, channelId string, initialMessageId string, fetcher messageFetcher, callback func(database.MessagePage) error) error {
+	fetchPage := func(prevMessages []*discordgo.Message) (database.MessagePage, error) {
+		return withRetry(ctx, i.Config, func() (database.MessagePage, error) {
+			return fetcher(ctx, channelId, initialMessageId, i.messageWindow(), i.Session, prevMessages)
+		})
+	}
+
+	page, err := fetchPage(nil)
 	if err != nil {
 		return err
 	}
 
-	for len(messages) > 0 {
-		err = callback(messages)
+	for len(page.Messages) > 0 {
+		err = callback(page)
 		if err != nil {
 			return err
 		}
 
 		log.Debug().
 			Str("channel_id", channelId).
-			Int("message_count", len(messages)).
-			Time("first_message_time", messages[0].Timestamp).
+			Int("message_count", len(page.Messages)).
+			Time("first_message_time", page.Messages[0].Timestamp).
 			Msg("Processed messages")
 
-		messages, err = fetcher(channelId, initialMessageId, i.Session, messages)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		page, err = fetchPage(page.Messages)
 		if err != nil {
 			return err
 		}
@@ -69,7 +254,7 @@ func (i *Importer) paginateMessages(channelId string, initialMessageId string, f
 	return nil
 }
 
-func (i *Importer) importChannelMessages(channel *discordgo.Channel) error {
+func (i *Importer) importChannelMessages(ctx context.Context, channel *discordgo.Channel) error {
 	// Channel has no messages
 	if channel.LastMessageID == "" {
 		return nil
@@ -80,41 +265,200 @@ func (i *Importer) importChannelMessages(channel *discordgo.Channel) error {
 		return fmt.Errorf("error getting last message timestamp: %w", err)
 	}
 
+	if i.Config.ImportSince != nil || i.Config.ImportUntil != nil {
+		// Channel has no messages in the window
+		if i.Config.ImportSince != nil && lastMessageSent.Before(*i.Config.ImportSince) {
+			return nil
+		}
+
+		return i.importChannelMessageWindow(ctx, channel)
+	}
+
 	channelId := channel.ID
 
+	var newerCheckpoint, olderCheckpoint *database.Checkpoint
+	err = i.withDb(func(db *sql.DB) error {
+		var err error
+
+		newerCheckpoint, err = database.GetCheckpoint(db, channelId, database.CheckpointDirectionNewer)
+		if err != nil {
+			return err
+		}
+
+		olderCheckpoint, err = database.GetCheckpoint(db, channelId, database.CheckpointDirectionOlder)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("error getting checkpoints: %w", err)
+	}
+
 	log.Debug().Msgf("Importing newer messages for channel %s", channelId)
 
-	newestMessageId, err := database.GetNewestMessageIdForChannel(i.Db, channelId)
-	if err == nil {
+	var newestMessageId string
+	if newerCheckpoint != nil {
+		newestMessageId = newerCheckpoint.Cursor
+	} else {
+		// Channels imported before checkpoints were introduced fall back to the newest stored message
+		err = i.withDb(func(db *sql.DB) error {
+			var err error
+			newestMessageId, err = database.GetNewestMessageIdForChannel(db, channelId)
+			return err
+		})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("error getting newest stored message: %w", err)
+		}
+	}
+
+	if newestMessageId != "" {
 		lastMessageStored, err := discordgo.SnowflakeTimestamp(newestMessageId)
 		if err != nil {
 			return fmt.Errorf("error getting newest message timestamp: %w", err)
 		}
 
-		if !lastMessageSent.After(lastMessageStored) {
-			log.Debug().Msg("Channel has all messages imported, no newer messages to import")
-			return nil
-		}
+		if lastMessageSent.After(lastMessageStored) {
+			err = i.paginateMessages(
+				ctx,
+				channelId,
+				newestMessageId,
+				newerMessageFetcher,
+				i.importMessagesWithCheckpoint(channelId, database.CheckpointDirectionNewer),
+			)
+			if err != nil {
+				return fmt.Errorf("error importing newer messages: %w", err)
+			}
 
-		err = i.paginateMessages(channelId, newestMessageId, newerMessageFetcher, i.importMessages)
-		if err != nil {
-			return fmt.Errorf("error importing newer messages: %w", err)
+			err = i.completeCheckpoint(channelId, database.CheckpointDirectionNewer, newestMessageId)
+			if err != nil {
+				return fmt.Errorf("error completing newer checkpoint: %w", err)
+			}
+		} else {
+			log.Debug().Msg("Channel has all messages imported, no newer messages to import")
 		}
 	} else {
 		log.Debug().Msg("Channel has no previous messages imported, no newer messages to import")
 	}
 
-	if i.Config.ImportOlder || err != nil {
+	olderCompleted := olderCheckpoint != nil && olderCheckpoint.Completed
+	olderInProgress := olderCheckpoint != nil && !olderCheckpoint.Completed
+
+	if olderCompleted {
+		log.Debug().Msg("Channel has all older messages imported")
+	} else if i.Config.ImportOlder || newestMessageId == "" || olderInProgress {
 		log.Debug().Msgf("Importing older messages for channel %s", channelId)
 
-		oldestMessageId, _ := database.GetOldestMessageIdForChannel(i.Db, channelId)
-		err = i.paginateMessages(channelId, oldestMessageId, olderMessageFetcher, i.importMessages)
+		var oldestMessageId string
+		if olderCheckpoint != nil {
+			oldestMessageId = olderCheckpoint.Cursor
+		} else {
+			err = i.withDb(func(db *sql.DB) error {
+				var err error
+				oldestMessageId, err = database.GetOldestMessageIdForChannel(db, channelId)
+				return err
+			})
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("error getting oldest stored message: %w", err)
+			}
+		}
+
+		err = i.paginateMessages(
+			ctx,
+			channelId,
+			oldestMessageId,
+			olderMessageFetcher,
+			i.importMessagesWithCheckpoint(channelId, database.CheckpointDirectionOlder),
+		)
 		if err != nil {
 			return fmt.Errorf("error importing older messages: %w", err)
 		}
+
+		err = i.completeCheckpoint(channelId, database.CheckpointDirectionOlder, oldestMessageId)
+		if err != nil {
+			return fmt.Errorf("error completing older checkpoint: %w", err)
+		}
+	}
+
+	if i.Config.Reconcile {
+		log.Debug().Msgf("Reconciling recent messages for channel %s", channelId)
+
+		err = i.reconcileChannelMessages(ctx, channelId)
+		if err != nil {
+			return fmt.Errorf("error reconciling messages: %w", err)
+		}
 	}
 
 	log.Debug().Msgf("Finished importing messages for channel %s", channelId)
 
 	return nil
 }
+
+// importChannelMessageWindow imports every message within the configured time window, newest first.
+// A window doesn't cover a channel's whole history, so checkpoints are left untouched.
+func (i *Importer) importChannelMessageWindow(ctx context.Context, channel *discordgo.Channel) error {
+	log.Debug().Msgf("Importing messages within window for channel %s", channel.ID)
+
+	err := i.paginateMessages(ctx, channel.ID, "", olderMessageFetcher, i.importMessages)
+	if err != nil {
+		return fmt.Errorf("error importing messages within window: %w", err)
+	}
+
+	return nil
+}
+
+// reconcileChannelMessages re-fetches all messages within the configured reconcile window,
+// marking any stored messages that no longer exist on Discord as deleted.
+func (i *Importer) reconcileChannelMessages(ctx context.Context, channelId string) error {
+	windowStart := time.Now().Add(-i.Config.ReconcileWindow)
+
+	seenIds := map[string]bool{}
+
+	err := i.paginateMessages(
+		ctx,
+		channelId,
+		snowflakeBeforeTime(windowStart),
+		newerMessageFetcher,
+		func(page database.MessagePage) error {
+			for _, message := range page.Messages {
+				seenIds[message.ID] = true
+			}
+
+			return i.importMessages(page)
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error fetching recent messages: %w", err)
+	}
+
+	deletedCount := 0
+
+	err = i.withDb(func(db *sql.DB) error {
+		storedIds, err := database.GetMessageIdsForChannelSince(db, channelId, windowStart)
+		if err != nil {
+			return fmt.Errorf("error getting stored message ids: %w", err)
+		}
+
+		for _, storedId := range storedIds {
+			if seenIds[storedId] {
+				continue
+			}
+
+			err = database.MarkMessageDeleted(db, storedId)
+			if err != nil {
+				return fmt.Errorf("error marking message as deleted: %w", err)
+			}
+
+			deletedCount++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Debug().
+		Str("channel_id", channelId).
+		Int("deleted_count", deletedCount).
+		Msg("Reconciled messages")
+
+	return nil
+}
@@ -0,0 +1,276 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nint8835/discordgo"
+
+	"github.com/nint8835/duckdbot/pkg/config"
+)
+
+func TestSnowflakeFromTime(t *testing.T) {
+	tests := []struct {
+		name string
+		time time.Time
+		want string
+	}{
+		{"discord epoch", time.UnixMilli(discordEpoch), "0"},
+		{"before discord epoch", time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC), "0"},
+		{"unix epoch", time.Unix(0, 0), "0"},
+		{"one second after discord epoch", time.UnixMilli(discordEpoch + 1000), "4194304000"},
+		{"real message", time.UnixMilli(1462015105796), "175928847298985984"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := snowflakeFromTime(test.time)
+			if got != test.want {
+				t.Errorf("snowflakeFromTime() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSnowflakeBeforeTime(t *testing.T) {
+	tests := []struct {
+		name string
+		time time.Time
+		want string
+	}{
+		{"discord epoch", time.UnixMilli(discordEpoch), "0"},
+		{"before discord epoch", time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC), "0"},
+		{"one millisecond after discord epoch", time.UnixMilli(discordEpoch + 1), "4194303"},
+		{"real message", time.UnixMilli(1462015105796), "175928847298985983"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := snowflakeBeforeTime(test.time)
+			if got != test.want {
+				t.Errorf("snowflakeBeforeTime() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMessageWindowBounds(t *testing.T) {
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	importer := &Importer{Config: &config.Config{ImportSince: &since, ImportUntil: &until}}
+	window := importer.messageWindow()
+
+	// Both bounds are exclusive when passed to Discord, so --since must be moved back by one to include messages sent
+	// at exactly that time, while --until is already exclusive
+	if compareSnowflakes(snowflakeFromTime(since), window.afterId) <= 0 {
+		t.Errorf("message sent at since %s is not after afterId %s", snowflakeFromTime(since), window.afterId)
+	}
+	if compareSnowflakes(snowflakeFromTime(until), window.beforeId) < 0 {
+		t.Errorf("message sent at until %s is before beforeId %s", snowflakeFromTime(until), window.beforeId)
+	}
+}
+
+func TestCompareSnowflakes(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1", "1", 0},
+		{"1", "2", -1},
+		{"2", "1", 1},
+		// Numeric rather than lexical ordering
+		{"9", "10", -1},
+		{"175928847299117063", "99999999999999999", 1},
+		{"0", "175928847299117063", -1},
+	}
+
+	for _, test := range tests {
+		got := compareSnowflakes(test.a, test.b)
+		if got != test.want {
+			t.Errorf("compareSnowflakes(%s, %s) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+const (
+	testFirstMessageId = 1000
+	testLastMessageId  = 1999
+)
+
+// newMessageServer serves a channel containing messages with every ID from testFirstMessageId to testLastMessageId,
+// paginating with before and after the same way Discord does, and points discordgo at it.
+func newMessageServer(t *testing.T) *discordgo.Session {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil {
+			t.Errorf("invalid limit %q", query.Get("limit"))
+		}
+
+		var ids []int
+		if after := query.Get("after"); after != "" {
+			afterId, _ := strconv.Atoi(after)
+			for id := max(afterId+1, testFirstMessageId); id <= testLastMessageId && len(ids) < limit; id++ {
+				ids = append(ids, id)
+			}
+			// Messages are always returned newest first
+			for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+				ids[i], ids[j] = ids[j], ids[i]
+			}
+		} else {
+			beforeId := testLastMessageId + 1
+			if before := query.Get("before"); before != "" {
+				beforeId, _ = strconv.Atoi(before)
+			}
+			for id := min(beforeId-1, testLastMessageId); id >= testFirstMessageId && len(ids) < limit; id-- {
+				ids = append(ids, id)
+			}
+		}
+
+		messages := make([]map[string]any, len(ids))
+		for index, id := range ids {
+			messages[index] = map[string]any{
+				"id":         strconv.Itoa(id),
+				"channel_id": "1",
+				"timestamp":  "2024-01-01T00:00:00Z",
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(messages)
+	}))
+	t.Cleanup(server.Close)
+
+	previousEndpoint := discordgo.EndpointChannels
+	discordgo.EndpointChannels = server.URL + "/channels/"
+	t.Cleanup(func() { discordgo.EndpointChannels = previousEndpoint })
+
+	session, err := discordgo.New("Bot token")
+	if err != nil {
+		t.Fatalf("error creating session: %s", err)
+	}
+
+	return session
+}
+
+// collectPages calls fetcher until it returns no messages, returning the first and last ID of each page.
+func collectPages(t *testing.T, session *discordgo.Session, fetcher messageFetcher, initialMessageId string, window messageWindow) [][2]string {
+	t.Helper()
+
+	var pages [][2]string
+	var prevMessages []*discordgo.Message
+
+	for range 100 {
+		page, err := fetcher(context.Background(), "1", initialMessageId, window, session, prevMessages)
+		if err != nil {
+			t.Fatalf("error fetching messages: %s", err)
+		}
+
+		if len(page.Messages) == 0 {
+			return pages
+		}
+
+		pages = append(pages, [2]string{page.Messages[0].ID, page.Messages[len(page.Messages)-1].ID})
+		prevMessages = page.Messages
+	}
+
+	t.Fatal("fetcher never ran out of messages")
+	return nil
+}
+
+func TestMessageFetcherWindows(t *testing.T) {
+	session := newMessageServer(t)
+
+	tests := []struct {
+		name             string
+		fetcher          messageFetcher
+		initialMessageId string
+		window           messageWindow
+		want             [][2]string
+	}{
+		{
+			name:    "older within window",
+			fetcher: olderMessageFetcher,
+			window:  messageWindow{afterId: "1450", beforeId: "1600"},
+			want:    [][2]string{{"1599", "1500"}, {"1499", "1451"}},
+		},
+		{
+			name:             "older from checkpoint inside window",
+			fetcher:          olderMessageFetcher,
+			initialMessageId: "1550",
+			window:           messageWindow{afterId: "1450", beforeId: "1600"},
+			want:             [][2]string{{"1549", "1451"}},
+		},
+		{
+			name:             "older from checkpoint after window",
+			fetcher:          olderMessageFetcher,
+			initialMessageId: "1900",
+			window:           messageWindow{beforeId: "1100"},
+			want:             [][2]string{{"1099", "1000"}},
+		},
+		{
+			name:    "newer within window",
+			fetcher: newerMessageFetcher,
+			window:  messageWindow{afterId: "1450", beforeId: "1600"},
+			want:    [][2]string{{"1550", "1451"}, {"1599", "1551"}},
+		},
+		{
+			name:             "newer from checkpoint inside window",
+			fetcher:          newerMessageFetcher,
+			initialMessageId: "1500",
+			window:           messageWindow{afterId: "1450", beforeId: "1600"},
+			want:             [][2]string{{"1599", "1501"}},
+		},
+		{
+			name:             "newer from checkpoint before window",
+			fetcher:          newerMessageFetcher,
+			initialMessageId: "1000",
+			window:           messageWindow{afterId: "1900"},
+			want:             [][2]string{{"1999", "1901"}},
+		},
+		{
+			// A message with the same ID as the --since bound is kept, as messageWindow passes the bound minus one
+			name:    "newer including message at since bound",
+			fetcher: newerMessageFetcher,
+			window:  messageWindow{afterId: "1449", beforeId: "1600"},
+			want:    [][2]string{{"1549", "1450"}, {"1599", "1550"}},
+		},
+		{
+			name:    "older including message at since bound",
+			fetcher: olderMessageFetcher,
+			window:  messageWindow{afterId: "1449", beforeId: "1600"},
+			want:    [][2]string{{"1599", "1500"}, {"1499", "1450"}},
+		},
+		{
+			name:    "window before any messages",
+			fetcher: olderMessageFetcher,
+			window:  messageWindow{afterId: "0", beforeId: "1000"},
+			want:    nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := collectPages(t, session, test.fetcher, test.initialMessageId, test.window)
+
+			if len(got) != len(test.want) {
+				t.Fatalf("got pages %v, want %v", got, test.want)
+			}
+			for index := range got {
+				if got[index] != test.want[index] {
+					t.Errorf("got pages %v, want %v", got, test.want)
+					break
+				}
+			}
+		})
+	}
+}
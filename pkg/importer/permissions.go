@@ -0,0 +1,114 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/nint8835/discordgo"
+)
+
+// requiredChannelPermissions are the permissions the bot needs in a channel to import its messages.
+var requiredChannelPermissions = []struct {
+	permission int64
+	name       string
+}{
+	{discordgo.PermissionViewChannel, "VIEW_CHANNEL"},
+	{discordgo.PermissionReadMessageHistory, "READ_MESSAGE_HISTORY"},
+}
+
+// channelPermissions computes a member's effective permissions in a channel from the guild's roles and the channel's
+// permission overwrites, following https://discord.com/developers/docs/topics/permissions#permission-hierarchy.
+func channelPermissions(guild *discordgo.Guild, member *discordgo.Member, channel *discordgo.Channel) int64 {
+	if member.User.ID == guild.OwnerID {
+		return discordgo.PermissionAll
+	}
+
+	var permissions int64
+	for _, role := range guild.Roles {
+		// The @everyone role shares its ID with the guild
+		if role.ID == guild.ID || slices.Contains(member.Roles, role.ID) {
+			permissions |= role.Permissions
+		}
+	}
+
+	// Administrators bypass channel overwrites entirely
+	if permissions&discordgo.PermissionAdministrator != 0 {
+		return discordgo.PermissionAll
+	}
+
+	for _, overwrite := range channel.PermissionOverwrites {
+		if overwrite.Type == discordgo.PermissionOverwriteTypeRole && overwrite.ID == guild.ID {
+			permissions &^= overwrite.Deny
+			permissions |= overwrite.Allow
+		}
+	}
+
+	// Role overwrites are combined before being applied, so an allow on any of the member's roles beats a deny on another
+	var roleDenies, roleAllows int64
+	for _, overwrite := range channel.PermissionOverwrites {
+		if overwrite.Type == discordgo.PermissionOverwriteTypeRole && slices.Contains(member.Roles, overwrite.ID) {
+			roleDenies |= overwrite.Deny
+			roleAllows |= overwrite.Allow
+		}
+	}
+	permissions &^= roleDenies
+	permissions |= roleAllows
+
+	for _, overwrite := range channel.PermissionOverwrites {
+		if overwrite.Type == discordgo.PermissionOverwriteTypeMember && overwrite.ID == member.User.ID {
+			permissions &^= overwrite.Deny
+			permissions |= overwrite.Allow
+		}
+	}
+
+	return permissions
+}
+
+// botChannelPermissions computes the bot's effective permissions in each of the given channels, keyed by channel ID.
+func (i *Importer) botChannelPermissions(ctx context.Context, channels []*discordgo.Channel) (map[string]int64, error) {
+	guild, err := withRetry(ctx, i.Config, func() (*discordgo.Guild, error) {
+		return i.Session.Guild(i.Config.GuildId, discordgo.WithContext(ctx))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting guild: %w", err)
+	}
+
+	botUser, err := withRetry(ctx, i.Config, func() (*discordgo.User, error) {
+		return i.Session.User("@me", discordgo.WithContext(ctx))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting bot user: %w", err)
+	}
+
+	botMember, err := withRetry(ctx, i.Config, func() (*discordgo.Member, error) {
+		return i.Session.GuildMember(i.Config.GuildId, botUser.ID, discordgo.WithContext(ctx))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting bot member: %w", err)
+	}
+
+	permissions := map[string]int64{}
+	for _, channel := range channels {
+		permissions[channel.ID] = channelPermissions(guild, botMember, channel)
+	}
+
+	return permissions, nil
+}
+
+// channelSkipReason returns why a channel can't be imported with the given permissions, or an empty string if it can.
+func channelSkipReason(permissions int64) string {
+	var missing []string
+	for _, required := range requiredChannelPermissions {
+		if permissions&required.permission == 0 {
+			missing = append(missing, required.name)
+		}
+	}
+
+	if len(missing) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("missing permissions %s", strings.Join(missing, ", "))
+}
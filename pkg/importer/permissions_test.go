@@ -0,0 +1,141 @@
+package importer
+
+import (
+	"testing"
+
+	"github.com/nint8835/discordgo"
+)
+
+const (
+	testGuildId     = "1"
+	testOwnerId     = "2"
+	testMemberId    = "3"
+	testRoleId      = "4"
+	testExtraRoleId = "5"
+	testUnheldId    = "7"
+)
+
+func TestChannelPermissions(t *testing.T) {
+	const read = discordgo.PermissionViewChannel | discordgo.PermissionReadMessageHistory
+
+	everyoneRole := &discordgo.Role{ID: testGuildId, Permissions: read}
+
+	tests := []struct {
+		name       string
+		roles      []*discordgo.Role
+		memberId   string
+		overwrites []*discordgo.PermissionOverwrite
+		want       int64
+	}{
+		{
+			name:     "no overwrites",
+			roles:    []*discordgo.Role{everyoneRole},
+			memberId: testMemberId,
+			want:     read,
+		},
+		{
+			name:     "owner",
+			roles:    []*discordgo.Role{{ID: testGuildId}},
+			memberId: testOwnerId,
+			overwrites: []*discordgo.PermissionOverwrite{
+				{ID: testGuildId, Type: discordgo.PermissionOverwriteTypeRole, Deny: read},
+			},
+			want: discordgo.PermissionAll,
+		},
+		{
+			name:     "administrator bypasses overwrites",
+			roles:    []*discordgo.Role{everyoneRole, {ID: testRoleId, Permissions: discordgo.PermissionAdministrator}},
+			memberId: testMemberId,
+			overwrites: []*discordgo.PermissionOverwrite{
+				{ID: testMemberId, Type: discordgo.PermissionOverwriteTypeMember, Deny: read},
+			},
+			want: discordgo.PermissionAll,
+		},
+		{
+			name:     "everyone overwrite denies",
+			roles:    []*discordgo.Role{everyoneRole},
+			memberId: testMemberId,
+			overwrites: []*discordgo.PermissionOverwrite{
+				{ID: testGuildId, Type: discordgo.PermissionOverwriteTypeRole, Deny: discordgo.PermissionViewChannel},
+			},
+			want: discordgo.PermissionReadMessageHistory,
+		},
+		{
+			name:     "role overwrite beats everyone overwrite",
+			roles:    []*discordgo.Role{everyoneRole, {ID: testRoleId}},
+			memberId: testMemberId,
+			overwrites: []*discordgo.PermissionOverwrite{
+				{ID: testGuildId, Type: discordgo.PermissionOverwriteTypeRole, Deny: read},
+				{ID: testRoleId, Type: discordgo.PermissionOverwriteTypeRole, Allow: discordgo.PermissionViewChannel},
+			},
+			want: discordgo.PermissionViewChannel,
+		},
+		{
+			name:     "role allow beats another role's deny",
+			roles:    []*discordgo.Role{everyoneRole, {ID: testRoleId}, {ID: testExtraRoleId}},
+			memberId: testMemberId,
+			overwrites: []*discordgo.PermissionOverwrite{
+				{ID: testRoleId, Type: discordgo.PermissionOverwriteTypeRole, Deny: discordgo.PermissionViewChannel},
+				{ID: testExtraRoleId, Type: discordgo.PermissionOverwriteTypeRole, Allow: discordgo.PermissionViewChannel},
+			},
+			want: read,
+		},
+		{
+			name:     "member overwrite beats role overwrite",
+			roles:    []*discordgo.Role{everyoneRole, {ID: testRoleId}},
+			memberId: testMemberId,
+			overwrites: []*discordgo.PermissionOverwrite{
+				{ID: testRoleId, Type: discordgo.PermissionOverwriteTypeRole, Allow: discordgo.PermissionManageThreads},
+				{ID: testMemberId, Type: discordgo.PermissionOverwriteTypeMember, Deny: discordgo.PermissionManageThreads | discordgo.PermissionViewChannel},
+			},
+			want: discordgo.PermissionReadMessageHistory,
+		},
+		{
+			name:     "overwrites for other roles and members are ignored",
+			roles:    []*discordgo.Role{everyoneRole},
+			memberId: testMemberId,
+			overwrites: []*discordgo.PermissionOverwrite{
+				{ID: testUnheldId, Type: discordgo.PermissionOverwriteTypeRole, Deny: read},
+				{ID: testUnheldId, Type: discordgo.PermissionOverwriteTypeMember, Deny: read},
+			},
+			want: read,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			guild := &discordgo.Guild{ID: testGuildId, OwnerID: testOwnerId, Roles: test.roles}
+			member := &discordgo.Member{
+				User:  &discordgo.User{ID: test.memberId},
+				Roles: []string{testRoleId, testExtraRoleId},
+			}
+			channel := &discordgo.Channel{ID: "6", PermissionOverwrites: test.overwrites}
+
+			got := channelPermissions(guild, member, channel)
+			if got != test.want {
+				t.Errorf("channelPermissions() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestChannelSkipReason(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions int64
+		want        string
+	}{
+		{"all required permissions", discordgo.PermissionViewChannel | discordgo.PermissionReadMessageHistory, ""},
+		{"missing history", discordgo.PermissionViewChannel, "missing permissions READ_MESSAGE_HISTORY"},
+		{"missing everything", 0, "missing permissions VIEW_CHANNEL, READ_MESSAGE_HISTORY"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := channelSkipReason(test.permissions)
+			if got != test.want {
+				t.Errorf("channelSkipReason() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
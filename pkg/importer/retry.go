@@ -0,0 +1,124 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nint8835/discordgo"
+	"github.com/rs/zerolog/log"
+
+	"github.com/nint8835/duckdbot/pkg/config"
+)
+
+// classifyError reports whether err is a transient failure worth retrying, along with how long Discord asked us to
+// wait before retrying, if it did.
+func classifyError(err error) (bool, time.Duration) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false, 0
+	}
+
+	var rateLimitErr *discordgo.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return true, rateLimitErr.RetryAfter
+	}
+
+	var serverErr *serverError
+	if errors.As(err, &serverErr) {
+		return true, serverErr.retryAfter
+	}
+
+	// Server errors are surfaced by the session's transport and rate limits by discordgo, so any other REST error is a
+	// client error, such as 403 Missing Access or 404 Unknown Channel, which will fail the same way every time
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) {
+		return false, 0
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true, 0
+	}
+
+	return false, 0
+}
+
+// restErrorStatus returns the HTTP status code of a Discord REST error, or 0 if err isn't one.
+func restErrorStatus(err error) int {
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Response != nil {
+		return restErr.Response.StatusCode
+	}
+
+	return 0
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of seconds or a date.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+
+	retryAt, err := http.ParseTime(header)
+	if err == nil {
+		return time.Until(retryAt)
+	}
+
+	return 0
+}
+
+// retryBackoff returns how long to wait before the given retry attempt, doubling from RetryInitialBackoff up to RetryMaxBackoff.
+func retryBackoff(cfg *config.Config, attempt int) time.Duration {
+	backoff := min(cfg.RetryInitialBackoff, cfg.RetryMaxBackoff)
+	for range attempt - 1 {
+		// Stop doubling once the limit is reached, so large attempt counts can't overflow
+		if backoff >= cfg.RetryMaxBackoff/2 {
+			backoff = cfg.RetryMaxBackoff
+			break
+		}
+		backoff *= 2
+	}
+
+	// Wait at least half the backoff so retries still slow down, randomising the rest so concurrent retries spread out
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// withRetry calls fn until it succeeds, fails with an error that isn't transient, or RetryAttempts attempts have been made.
+func withRetry[T any](ctx context.Context, cfg *config.Config, fn func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := fn()
+		if err == nil {
+			return result, nil
+		}
+
+		transient, retryAfter := classifyError(err)
+		if !transient {
+			return result, err
+		}
+
+		if attempt >= cfg.RetryAttempts {
+			return result, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		delay := max(retryBackoff(cfg, attempt), retryAfter)
+
+		log.Warn().Err(err).Int("attempt", attempt).Dur("delay", delay).Msg("Discord request failed, retrying")
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return result, ctx.Err()
+		}
+	}
+}
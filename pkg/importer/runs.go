@@ -0,0 +1,143 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/nint8835/duckdbot/pkg/database"
+)
+
+const (
+	// ErrorPolicyContinue records errors and carries on importing everything else
+	ErrorPolicyContinue = "continue"
+	// ErrorPolicyFailFast stops the import at the first error
+	ErrorPolicyFailFast = "fail-fast"
+)
+
+// SkippedChannel is a channel which wasn't imported because the bot can't read it.
+type SkippedChannel struct {
+	Id     string
+	Name   string
+	Reason string
+}
+
+// RunSummary describes the outcome of an import run.
+type RunSummary struct {
+	RunId           int64
+	Status          string
+	Counts          map[string]database.UpsertCounts
+	Errors          []error
+	SkippedChannels []SkippedChannel
+}
+
+// importRun accumulates the outcome of an import while it is running, so it can be recorded in the import_runs table
+// once it finishes.
+type importRun struct {
+	id int64
+
+	// cancel stops the import, and is used to fail fast when an error is reported
+	cancel context.CancelCauseFunc
+
+	lock            sync.Mutex
+	counts          map[string]database.UpsertCounts
+	errors          []error
+	skippedChannels []SkippedChannel
+}
+
+func (r *importRun) addCounts(entity string, counts database.UpsertCounts) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	entityCounts := r.counts[entity]
+	entityCounts.Merge(counts)
+	r.counts[entity] = entityCounts
+}
+
+func (r *importRun) addResult(entity string, result database.UpsertResult) {
+	var counts database.UpsertCounts
+	counts.Add(result)
+
+	r.addCounts(entity, counts)
+}
+
+func (r *importRun) addSkippedChannel(channel SkippedChannel) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.skippedChannels = append(r.skippedChannels, channel)
+}
+
+func (r *importRun) addError(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.errors = append(r.errors, err)
+}
+
+func (i *Importer) startRun(cancel context.CancelCauseFunc) error {
+	runId, err := database.StartImportRun(i.Db, i.Config)
+	if err != nil {
+		return err
+	}
+
+	i.run = &importRun{id: runId, cancel: cancel, counts: map[string]database.UpsertCounts{}}
+
+	return nil
+}
+
+// finishRun records the outcome of the current import run and returns a summary of it. If status is empty, it is
+// determined from whether any errors were reported during the run.
+func (i *Importer) finishRun(status string) *RunSummary {
+	i.run.lock.Lock()
+	defer i.run.lock.Unlock()
+
+	if status == "" {
+		status = database.RunStatusSucceeded
+		if len(i.run.errors) > 0 {
+			status = database.RunStatusFailed
+		}
+	}
+
+	errorMessages := make([]string, len(i.run.errors))
+	for index, err := range i.run.errors {
+		errorMessages[index] = err.Error()
+	}
+
+	err := database.FinishImportRun(i.Db, i.run.id, status, i.run.counts, errorMessages)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to record import run")
+	}
+
+	log.Info().Int64("run_id", i.run.id).Int("error_count", len(i.run.errors)).Msgf("Import run %s", status)
+
+	return &RunSummary{
+		RunId:           i.run.id,
+		Status:          status,
+		Counts:          maps.Clone(i.run.counts),
+		Errors:          append([]error(nil), i.run.errors...),
+		SkippedChannels: append([]SkippedChannel(nil), i.run.skippedChannels...),
+	}
+}
+
+// reportError logs an error and records it against the current import run, stopping the import if the error policy
+// is to fail fast.
+func (i *Importer) reportError(err error, msg string) {
+	// Errors caused by the import being stopped aren't failures in their own right
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	log.Error().Err(err).Msg(msg)
+
+	err = fmt.Errorf("%s: %w", msg, err)
+	i.run.addError(err)
+
+	if i.Config.ErrorPolicy == ErrorPolicyFailFast {
+		i.run.cancel(err)
+	}
+}
@@ -0,0 +1,54 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// serverError is returned for Discord responses with a 5xx status, along with how long Discord asked us to wait
+// before retrying, if it did.
+type serverError struct {
+	statusCode int
+	retryAfter time.Duration
+}
+
+func (e *serverError) Error() string {
+	return fmt.Sprintf("discord returned HTTP %d", e.statusCode)
+}
+
+type serverErrorTransport struct {
+	base http.RoundTripper
+}
+
+// NewServerErrorTransport wraps base so that 5xx responses are returned as errors carrying their status and Retry-After
+// header. discordgo otherwise replaces them with a plain error once its own retries are exhausted, leaving the importer
+// no way to tell them apart from other failures. A nil base uses http.DefaultTransport.
+func NewServerErrorTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &serverErrorTransport{base: base}
+}
+
+func (t *serverErrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 500 {
+		return resp, nil
+	}
+
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	return nil, &serverError{
+		statusCode: resp.StatusCode,
+		retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
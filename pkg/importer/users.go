@@ -1,66 +1,197 @@
 package importer
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
 	"github.com/nint8835/discordgo"
 	"github.com/rs/zerolog/log"
 
 	"github.com/nint8835/duckdbot/pkg/database"
 )
 
-func (i *Importer) importMembers() {
-	guildMembers, err := i.Session.GuildMembers(i.Config.GuildId, "", 1000)
+// memberChunkTimeout is how long to wait for the next member chunk when requesting members over the gateway.
+const memberChunkTimeout = 30 * time.Second
+
+func (i *Importer) paginateGuildMembers(ctx context.Context, callback func([]*discordgo.Member)) error {
+	after := ""
+
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		members, err := withRetry(ctx, i.Config, func() ([]*discordgo.Member, error) {
+			return i.Session.GuildMembers(i.Config.GuildId, after, 1000, discordgo.WithContext(ctx))
+		})
+		if err != nil {
+			return fmt.Errorf("error getting guild members: %w", err)
+		}
+
+		callback(members)
+
+		if len(members) < 1000 {
+			return nil
+		}
+
+		after = members[len(members)-1].User.ID
+	}
+}
+
+func (i *Importer) requestGuildMembers(ctx context.Context, callback func([]*discordgo.Member)) error {
+	nonce := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	chunks := make(chan *discordgo.GuildMembersChunk)
+	done := make(chan struct{})
+	defer close(done)
+
+	removeHandler := i.Session.AddHandler(func(_ *discordgo.Session, chunk *discordgo.GuildMembersChunk) {
+		if chunk.Nonce != nonce {
+			return
+		}
+
+		select {
+		case chunks <- chunk:
+		case <-done:
+		}
+	})
+	defer removeHandler()
+
+	err := i.Session.RequestGuildMembers(i.Config.GuildId, "", 0, nonce, false)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to get guild members")
+		return fmt.Errorf("error requesting guild members: %w", err)
+	}
+
+	// Chunks are not guaranteed to arrive in order, so count them rather than relying on the chunk index
+	receivedChunks := 0
+
+	for {
+		select {
+		case chunk := <-chunks:
+			callback(chunk.Members)
+
+			receivedChunks++
+			if receivedChunks >= chunk.ChunkCount {
+				return nil
+			}
+		case <-time.After(memberChunkTimeout):
+			return fmt.Errorf("timed out waiting for guild member chunks after receiving %d", receivedChunks)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (i *Importer) importMembers(ctx context.Context) {
+	var fetchMembers func(context.Context, func([]*discordgo.Member)) error
+
+	switch i.Config.MemberSource {
+	case "rest":
+		fetchMembers = i.paginateGuildMembers
+	case "gateway":
+		fetchMembers = i.requestGuildMembers
+	default:
+		i.reportError(fmt.Errorf("unknown member source %s", i.Config.MemberSource), "failed to import members")
 		return
 	}
 
-	for _, guildMember := range guildMembers {
-		log.Info().Msgf("Importing member %s", guildMember.User.Username)
+	importedCount := 0
+	importedIds := map[string]bool{}
+	insertFailed := false
 
-		err = database.InsertMember(i.Db, guildMember)
+	err := fetchMembers(ctx, func(guildMembers []*discordgo.Member) {
+		for _, guildMember := range guildMembers {
+			log.Info().Msgf("Importing member %s", guildMember.User.Username)
+			importedIds[guildMember.User.ID] = true
+
+			// Members fetched over REST don't include a guild ID, which is needed to build guild-specific avatar URLs
+			if guildMember.GuildID == "" {
+				guildMember.GuildID = i.Config.GuildId
+			}
+		}
+
+		counts, err := database.InsertMembers(i.Db, guildMembers)
 		if err != nil {
-			log.Error().Err(err).Msg("failed to insert member")
-			continue
+			i.reportError(err, "failed to insert members")
+			insertFailed = true
+			return
+		}
+
+		i.run.addCounts("members", counts)
+		importedCount += len(guildMembers)
+	})
+	if err != nil {
+		i.reportError(err, "failed to get guild members")
+	}
+
+	// Departures can only be detected from a complete member list
+	if err == nil && !insertFailed && ctx.Err() == nil {
+		departedCount, err := i.closeMissing(importedIds, database.GetCurrentMemberIds, database.MarkMemberDeparted)
+		if err != nil {
+			i.reportError(err, "failed to mark departed members")
+		} else {
+			log.Info().Msgf("Marked %d members as departed", departedCount)
 		}
 	}
+
+	guild, err := withRetry(ctx, i.Config, func() (*discordgo.Guild, error) {
+		return i.Session.GuildWithCounts(i.Config.GuildId, discordgo.WithContext(ctx))
+	})
+	if err != nil {
+		i.reportError(err, "failed to get guild member count")
+		return
+	}
+
+	log.Info().
+		Int("imported_count", importedCount).
+		Int("approximate_member_count", guild.ApproximateMemberCount).
+		Msg("Imported members")
 }
 
-func (i *Importer) importMissingUsers() {
+func (i *Importer) importMissingUsers(ctx context.Context) {
 	missingAuthors, err := database.GetMissingAuthors(i.Db)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to get missing authors")
+		i.reportError(err, "failed to get missing authors")
 		return
 	}
 
 	for _, author := range missingAuthors {
+		if ctx.Err() != nil {
+			return
+		}
+
 		log.Info().Msgf("Importing user %s", author)
 
 		cached, err := database.GetCachedUser(i.Db, author)
 		if err != nil {
-			log.Error().Err(err).Msgf("failed to get cached user %s", author)
+			i.reportError(err, fmt.Sprintf("failed to get cached user %s", author))
 			continue
 		}
 
 		if cached != nil {
 			log.Debug().Msg("Importing cached user")
 
-			err = database.InsertUser(i.Db, &discordgo.User{
+			result, err := database.InsertUser(i.Db, &discordgo.User{
 				ID:         cached.Id,
 				Username:   cached.Username,
 				GlobalName: cached.DisplayName,
 				Bot:        cached.IsBot,
 			})
 			if err != nil {
-				log.Error().Err(err).Msgf("failed to import cached user %s", author)
+				i.reportError(err, fmt.Sprintf("failed to import cached user %s", author))
 				continue
 			}
+			i.run.addResult("users", result)
 
 			continue
 		}
 
 		invalid, err := database.GetInvalidCachedUser(i.Db, author)
 		if err != nil {
-			log.Error().Err(err).Msgf("failed to get invalid cached user %s", author)
+			i.reportError(err, fmt.Sprintf("failed to get invalid cached user %s", author))
 			continue
 		}
 
@@ -69,33 +200,47 @@ func (i *Importer) importMissingUsers() {
 			continue
 		}
 
-		user, err := i.Session.User(author)
+		user, err := withRetry(ctx, i.Config, func() (*discordgo.User, error) {
+			return i.Session.User(author, discordgo.WithContext(ctx))
+		})
+		if ctx.Err() != nil {
+			return
+		}
 		if err != nil {
-			log.Error().Err(err).Msgf("failed to get user %s", author)
+			// Only users Discord permanently refuses to return, such as deleted accounts, are remembered so they aren't
+			// requested again. Any other failure may succeed next run.
+			status := restErrorStatus(err)
+			if status != http.StatusNotFound && status != http.StatusForbidden {
+				i.reportError(err, fmt.Sprintf("failed to get user %s", author))
+				continue
+			}
+
+			log.Warn().Msgf("User %s unavailable (HTTP %d)", author, status)
 
-			err = database.InsertInvalidCachedUser(i.Db, author)
+			err = database.UpsertInvalidCachedUser(i.Db, author)
 			if err != nil {
-				log.Error().Err(err).Msgf("failed to cache invalid user %s", author)
+				i.reportError(err, fmt.Sprintf("failed to cache invalid user %s", author))
 			}
 
 			continue
 		}
 
-		err = database.InsertUser(i.Db, user)
+		result, err := database.InsertUser(i.Db, user)
 		if err != nil {
-			log.Error().Err(err).Msgf("failed to import user %s", author)
+			i.reportError(err, fmt.Sprintf("failed to import user %s", author))
 			continue
 		}
+		i.run.addResult("users", result)
 
 		err = database.UpsertCachedUser(i.Db, user)
 		if err != nil {
-			log.Error().Err(err).Msgf("failed to cache user %s", author)
+			i.reportError(err, fmt.Sprintf("failed to cache user %s", author))
 			continue
 		}
 
 		err = database.DeleteInvalidCachedUser(i.Db, author)
 		if err != nil {
-			log.Error().Err(err).Msgf("failed to delete invalid cached user %s", author)
+			i.reportError(err, fmt.Sprintf("failed to delete invalid cached user %s", author))
 			continue
 		}
 	}
@@ -0,0 +1,45 @@
+package importer
+
+import (
+	"database/sql"
+)
+
+// dbJob is a unit of database work to be run by the writer goroutine.
+type dbJob struct {
+	fn   func(db *sql.DB) error
+	done chan error
+}
+
+// startWriter starts a goroutine that serializes all database access while channels are being imported concurrently.
+func (i *Importer) startWriter() {
+	i.dbJobs = make(chan dbJob)
+	i.writerDone = make(chan struct{})
+
+	go func() {
+		defer close(i.writerDone)
+
+		for job := range i.dbJobs {
+			job.done <- job.fn(i.Db)
+		}
+	}()
+}
+
+// stopWriter waits for all submitted database work to finish and stops the writer goroutine.
+func (i *Importer) stopWriter() {
+	close(i.dbJobs)
+	<-i.writerDone
+
+	i.dbJobs = nil
+}
+
+// withDb runs fn against the database on the writer goroutine, or directly if the writer is not running.
+func (i *Importer) withDb(fn func(db *sql.DB) error) error {
+	if i.dbJobs == nil {
+		return fn(i.Db)
+	}
+
+	done := make(chan error, 1)
+	i.dbJobs <- dbJob{fn: fn, done: done}
+
+	return <-done
+}
@@ -31,7 +31,12 @@ db.sql("SET allow_community_extensions = false")
 db.sql("SET lock_configuration = true")
 
 schema = "\n".join(
-    [table[0] for table in db.sql("SELECT sql FROM duckdb_tables()").fetchall()]
+    [
+        table[0]
+        for table in db.sql(
+            "SELECT sql FROM duckdb_tables() UNION ALL SELECT sql FROM duckdb_views() WHERE NOT internal"
+        ).fetchall()
+    ]
 )
 
 model = OpenAIChatModel(